@@ -1,6 +1,8 @@
 package lbclient
 
-import ()
+import (
+	"context"
+)
 
 type DataServiceClient interface {
 	Find(request *FindRequest, returndata interface{}) (*Response, error)
@@ -10,9 +12,54 @@ type DataServiceClient interface {
 	Delete(request *DeleteRequest) (*Response, error)
 }
 
+// ContextDataServiceClient is a DataServiceClient whose calls can be
+// cancelled, or bounded by a deadline, using a context
+type ContextDataServiceClient interface {
+	DataServiceClient
+	FindContext(ctx context.Context, request *FindRequest, returndata interface{}) (*Response, error)
+	InsertContext(ctx context.Context, request *InsertRequest, returndata interface{}) (*Response, error)
+	UpdateContext(ctx context.Context, request *UpdateRequest, returndata interface{}) (*Response, error)
+	SaveContext(ctx context.Context, request *SaveRequest, returndata interface{}) (*Response, error)
+	DeleteContext(ctx context.Context, request *DeleteRequest) (*Response, error)
+}
+
 type LockingClient interface {
 	Acquire(domain, callerId, resourceId string, ttl int) (bool, error)
 	Release(domain, callerId, resourceId string) (bool, error)
 	GetLockCount(domain, callerId, resourceId string) (int, error)
 	Ping(domain, callerId, resourceId string) (bool, error)
 }
+
+// ContextLockingClient is a LockingClient whose calls can be
+// cancelled, or bounded by a deadline, using a context
+type ContextLockingClient interface {
+	LockingClient
+	AcquireContext(ctx context.Context, domain, callerId, resourceId string, ttl int) (bool, error)
+	ReleaseContext(ctx context.Context, domain, callerId, resourceId string) (bool, error)
+	GetLockCountContext(ctx context.Context, domain, callerId, resourceId string) (int, error)
+	PingContext(ctx context.Context, domain, callerId, resourceId string) (bool, error)
+}
+
+// MetadataClient manages entity metadata using the metadata service
+type MetadataClient interface {
+	// GetEntityNames returns the names of the entities. If statuses
+	// are given, only the entities having a version in one of those
+	// statuses are returned
+	GetEntityNames(ctx context.Context, statuses ...MetadataStatus) ([]string, error)
+	// GetEntityVersions returns the versions of an entity
+	GetEntityVersions(ctx context.Context, entityName string) ([]EntityVersion, error)
+	// GetMetadata returns the entity info and schema of an entity version
+	GetMetadata(ctx context.Context, entityName, version string) (*EntityMetadata, error)
+	// CreateMetadata creates a new entity with its first schema version
+	CreateMetadata(ctx context.Context, md *EntityMetadata) (*EntityMetadata, error)
+	// CreateSchema adds a new schema version to an existing entity
+	CreateSchema(ctx context.Context, schema *EntitySchema) (*EntityMetadata, error)
+	// UpdateEntityInfo updates the entity info of an existing entity
+	UpdateEntityInfo(ctx context.Context, info *EntityInfo) (*EntityMetadata, error)
+	// UpdateSchemaStatus changes the status of a schema version
+	UpdateSchemaStatus(ctx context.Context, entityName, version string, status MetadataStatus, comment string) (*EntityMetadata, error)
+	// SetDefaultVersion sets the default version of an entity
+	SetDefaultVersion(ctx context.Context, entityName, version string) (*EntityMetadata, error)
+	// RemoveEntity removes an entity and all its versions
+	RemoveEntity(ctx context.Context, entityName string) error
+}
@@ -0,0 +1,229 @@
+package lbclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Date is a time.Time encoded in the lightblue date format,
+// DATEFORMAT. Use Date for date fields of documents, so they can be
+// sent to and received from lightblue:
+//
+//	type Doc struct {
+//		Created lbclient.Date `json:"created"`
+//	}
+//
+// When decoding, Date accepts all the formats accepted by ParseDate,
+// and numbers as milliseconds since epoch. A JSON null leaves the
+// date unchanged
+type Date struct {
+	time.Time
+}
+
+// NullDate is a Date that can be null. If Valid is false, the date is
+// encoded as null
+type NullDate struct {
+	Date
+	Valid bool
+}
+
+// DateOf returns t as a Date
+func DateOf(t time.Time) Date {
+	return Date{Time: t}
+}
+
+// NullDateOf returns a valid NullDate for t
+func NullDateOf(t time.Time) NullDate {
+	return NullDate{Date: Date{Time: t}, Valid: true}
+}
+
+// dateFormats are the formats accepted by ParseDate, in the order
+// they are tried
+var dateFormats = []string{
+	DATEFORMAT,
+	"20060102T15:04:05.000Z0700",
+	"20060102T15:04:05Z0700",
+	"20060102T15:04:05.000",
+	"20060102T15:04:05",
+	"20060102",
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.000-0700",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+// ParseDate parses a date in the lightblue date format, or one of the
+// alternative formats accepted by the lightblue server: the lightblue
+// format with a Z zone, without milliseconds, or without a zone,
+// yyyyMMdd, RFC3339 with or without a zone, and yyyy-MM-dd. Dates
+// without a zone are in UTC
+func ParseDate(s string) (time.Time, error) {
+	for _, f := range dateFormats {
+		if t, err := time.Parse(f, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid date: %s", s)
+}
+
+// String returns the date in the lightblue date format
+func (d Date) String() string {
+	return d.Format(DATEFORMAT)
+}
+
+// MarshalJSON returns the date as a JSON string in the lightblue date
+// format
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.Format(DATEFORMAT))
+}
+
+// UnmarshalJSON decodes a date string using ParseDate, or a number as
+// milliseconds since epoch
+func (d *Date) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	t, err := decodeDate(data)
+	if err != nil {
+		return err
+	}
+	d.Time = t
+	return nil
+}
+
+// AppendText appends the date in the lightblue date format to b. It
+// replaces the RFC3339 AppendText of time.Time, which encoding/json
+// uses for map keys
+func (d Date) AppendText(b []byte) ([]byte, error) {
+	return d.AppendFormat(b, DATEFORMAT), nil
+}
+
+// MarshalText returns the date in the lightblue date format. It
+// replaces the RFC3339 MarshalText of time.Time
+func (d Date) MarshalText() ([]byte, error) {
+	return d.AppendText(nil)
+}
+
+// UnmarshalText decodes a date using ParseDate
+func (d *Date) UnmarshalText(text []byte) error {
+	t, err := ParseDate(string(text))
+	if err != nil {
+		return err
+	}
+	d.Time = t
+	return nil
+}
+
+func decodeDate(data []byte) (time.Time, error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		ms, err := strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Invalid date: %s", string(data))
+		}
+		return time.UnixMilli(ms).UTC(), nil
+	}
+	return ParseDate(s)
+}
+
+// MarshalJSON returns null if the date is not valid, or the date in
+// the lightblue date format
+func (d NullDate) MarshalJSON() ([]byte, error) {
+	if !d.Valid {
+		return []byte("null"), nil
+	}
+	return d.Date.MarshalJSON()
+}
+
+// UnmarshalJSON decodes null as an invalid date, and other values
+// as Date does
+func (d *NullDate) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*d = NullDate{}
+		return nil
+	}
+	t, err := decodeDate(data)
+	if err != nil {
+		return err
+	}
+	*d = NullDateOf(t)
+	return nil
+}
+
+// AppendText appends nothing to b if the date is not valid, or the
+// date in the lightblue date format
+func (d NullDate) AppendText(b []byte) ([]byte, error) {
+	if !d.Valid {
+		return b, nil
+	}
+	return d.Date.AppendText(b)
+}
+
+// MarshalText returns an empty text if the date is not valid, or the
+// date in the lightblue date format
+func (d NullDate) MarshalText() ([]byte, error) {
+	return d.AppendText([]byte{})
+}
+
+// UnmarshalText decodes an empty text as an invalid date, and other
+// texts as Date does
+func (d *NullDate) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*d = NullDate{}
+		return nil
+	}
+	var date Date
+	if err := date.UnmarshalText(text); err != nil {
+		return err
+	}
+	*d = NullDate{Date: date, Valid: true}
+	return nil
+}
+
+// withDates returns a copy of a document tree with time.Time values
+// replaced by Date, so they are encoded in the lightblue date format
+func withDates(v interface{}) interface{} {
+	switch x := v.(type) {
+	case time.Time:
+		return Date{Time: x}
+	case *time.Time:
+		if x == nil {
+			return nil
+		}
+		return Date{Time: *x}
+	case map[string]interface{}:
+		if x == nil {
+			return x
+		}
+		m := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			m[k] = withDates(e)
+		}
+		return m
+	case []map[string]interface{}:
+		if x == nil {
+			return x
+		}
+		arr := make([]map[string]interface{}, len(x))
+		for i, e := range x {
+			arr[i] = withDates(e).(map[string]interface{})
+		}
+		return arr
+	case []interface{}:
+		if x == nil {
+			return x
+		}
+		arr := make([]interface{}, len(x))
+		for i, e := range x {
+			arr[i] = withDates(e)
+		}
+		return arr
+	}
+	return v
+}
@@ -0,0 +1,96 @@
+package lbclient
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	expected := time.Date(2017, time.January, 15, 13, 11, 15, 123000000, time.UTC)
+	for _, s := range []string{
+		"20170115T13:11:15.123+0000",
+		"20170115T14:11:15.123+0100",
+		"20170115T13:11:15.123Z",
+		"20170115T13:11:15.123",
+		"2017-01-15T13:11:15.123Z",
+		"2017-01-15T08:11:15.123-05:00",
+		"2017-01-15T13:11:15.123+0000",
+		"2017-01-15T13:11:15.123",
+	} {
+		d, err := ParseDate(s)
+		if err != nil {
+			t.Errorf("%s: %s", s, err)
+		} else if !d.Equal(expected) {
+			t.Errorf("%s: expected %s, got %s", s, expected, d)
+		}
+	}
+	for _, s := range []string{"20170115", "2017-01-15"} {
+		if d, err := ParseDate(s); err != nil || !d.Equal(time.Date(2017, time.January, 15, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("%s: got %s, %v", s, d, err)
+		}
+	}
+	if _, err := ParseDate("15/01/2017"); err == nil {
+		t.Errorf("Expected error")
+	}
+}
+
+type dateDoc struct {
+	Created  Date     `json:"created"`
+	Modified NullDate `json:"modified"`
+	Deleted  NullDate `json:"deleted"`
+}
+
+func TestDateJSON(t *testing.T) {
+	date := time.Date(2017, time.January, 15, 13, 11, 15, 123000000, time.UTC)
+	doc := dateDoc{Created: DateOf(date), Modified: NullDateOf(date)}
+	cmp(t, `{"created":"20170115T13:11:15.123+0000","modified":"20170115T13:11:15.123+0000","deleted":null}`, doc)
+
+	var out dateDoc
+	if err := json.Unmarshal([]byte(`{"created":"2017-01-15T13:11:15.123Z","modified":1484485875123,"deleted":null}`), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Created.Equal(date) || !out.Modified.Valid || !out.Modified.Equal(date) || out.Deleted.Valid {
+		t.Errorf("Wrong dates: %+v", out)
+	}
+	if err := json.Unmarshal([]byte(`{"created":"yesterday"}`), &out); err == nil {
+		t.Errorf("Expected error")
+	}
+
+	// Text is in the lightblue date format, also for map keys
+	cmp(t, `{"20170115T13:11:15.123+0000":1}`, map[Date]int{DateOf(date): 1})
+	var keys map[Date]int
+	if err := json.Unmarshal([]byte(`{"20170115T13:11:15.123+0000":1}`), &keys); err != nil || len(keys) != 1 {
+		t.Fatalf("Wrong map: %v %v", keys, err)
+	}
+	for k := range keys {
+		if !k.Equal(date) {
+			t.Errorf("Wrong key: %s", k)
+		}
+	}
+	var null NullDate
+	if text, err := null.MarshalText(); err != nil || len(text) != 0 {
+		t.Errorf("Wrong null date text: %q %v", text, err)
+	}
+	if err := null.UnmarshalText([]byte("20170115T13:11:15.123+0000")); err != nil || !null.Valid || !null.Equal(date) {
+		t.Errorf("Wrong null date: %+v %v", null, err)
+	}
+}
+
+func TestDateIntegration(t *testing.T) {
+	date := time.Date(2017, time.January, 15, 13, 11, 15, 123000000, time.UTC)
+	cmp(t, `{"field":"d","op":"!=","rvalue":"20170115T13:11:15.123+0000"}`, mustQuery(CmpValueOf("d", NEQ, DateOf(date))))
+	cmp(t, `{"field":"d","op":"=","rvalue":null}`, mustQuery(CmpValueOf("d", EQ, NullDate{})))
+	data := MakeDocData(map[string]interface{}{"d": date, "arr": []interface{}{&date}, "n": nil})
+	if string(data) != `[{"arr":["20170115T13:11:15.123+0000"],"d":"20170115T13:11:15.123+0000","n":null}]` {
+		t.Errorf("Wrong doc data: %s", string(data))
+	}
+	data = MakeDocData(dateDoc{Created: DateOf(date)})
+	if string(data) != `[{"created":"20170115T13:11:15.123+0000","modified":null,"deleted":null}]` {
+		t.Errorf("Wrong doc data: %s", string(data))
+	}
+	ok, err := mustQuery(CmpValueOf("created", EQ, DateOf(date))).Matches(map[string]interface{}{"created": date})
+	if err != nil || !ok {
+		t.Errorf("Expected match: %v", err)
+	}
+}
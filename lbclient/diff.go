@@ -0,0 +1,326 @@
+package lbclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lightblue-platform/go-client/lbclient/internal/eval"
+)
+
+// DiffUpdate returns the update expression that changes the document
+// before into the document after. The documents are structs or maps,
+// and are compared using their JSON representations. The update
+// contains:
+//
+//   - $set for added and changed fields. Changed array elements are
+//     set individually if the array length is unchanged,
+//   - $set with ValueOfField for objects and arrays moved from a
+//     removed field,
+//   - $unset for removed fields,
+//   - $append for elements added to the end of an array,
+//   - $foreach with $remove for elements removed from an array, if
+//     the removed elements can be selected with a query.
+//
+// Arrays with other changes are set as a whole. If the documents are
+// the same, an empty update is returned
+func DiffUpdate(before, after interface{}) (*Update, error) {
+	b, err := diffDocument(before)
+	if err != nil {
+		return nil, fmt.Errorf("before: %s", err)
+	}
+	a, err := diffDocument(after)
+	if err != nil {
+		return nil, fmt.Errorf("after: %s", err)
+	}
+	d := differ{removed: make(map[string]interface{})}
+	d.collectRemoved("", b, a)
+	if err := d.object("", b, a); err != nil {
+		return nil, err
+	}
+	return d.update(), nil
+}
+
+// diffDocument returns the JSON tree of a struct or map document
+func diffDocument(v interface{}) (map[string]interface{}, error) {
+	tree, err := jsonTree(withDates(v))
+	if err != nil {
+		return nil, err
+	}
+	m, ok := tree.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Expected document, got %T", v)
+	}
+	return m, nil
+}
+
+// diffEqual compares two JSON trees using their canonical encodings
+func diffEqual(a, b interface{}) bool {
+	x, err1 := json.Marshal(a)
+	y, err2 := json.Marshal(b)
+	return err1 == nil && err2 == nil && bytes.Equal(x, y)
+}
+
+type differ struct {
+	// Fields removed from before, and their values
+	removed map[string]interface{}
+	sets    []updatePart
+	unsets  []updatePart
+}
+
+// update returns the update with $unset operations last, so
+// $valueof refers to the fields before they are removed
+func (d *differ) update() *Update {
+	u := &Update{}
+	for _, p := range d.sets {
+		u.add(p)
+	}
+	for _, p := range d.unsets {
+		u.add(p)
+	}
+	return u
+}
+
+func diffPath(prefix, field string) (string, error) {
+	if len(field) == 0 || strings.ContainsAny(field, ".*#") || field[0] == '$' {
+		return "", fmt.Errorf("Cannot address field %q", field)
+	}
+	return joinField(prefix, field), nil
+}
+
+func sortedTreeKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// collectRemoved records the object and array values of the fields
+// removed from before, so they can be referred to by $valueof
+func (d *differ) collectRemoved(prefix string, b, a map[string]interface{}) {
+	for _, k := range sortedTreeKeys(b) {
+		path, err := diffPath(prefix, k)
+		if err != nil {
+			continue
+		}
+		av, ok := a[k]
+		if !ok {
+			switch b[k].(type) {
+			case map[string]interface{}, []interface{}:
+				d.removed[path] = b[k]
+			}
+			continue
+		}
+		bm, ok1 := b[k].(map[string]interface{})
+		am, ok2 := av.(map[string]interface{})
+		if ok1 && ok2 {
+			d.collectRemoved(path, bm, am)
+		}
+	}
+}
+
+// movedFrom returns the removed field with the value v
+func (d *differ) movedFrom(v interface{}) (string, bool) {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+	default:
+		return "", false
+	}
+	var fields []string
+	for f, x := range d.removed {
+		if diffEqual(x, v) {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		return "", false
+	}
+	sort.Strings(fields)
+	return fields[0], true
+}
+
+func (d *differ) set(path string, v interface{}) error {
+	if from, ok := d.movedFrom(v); ok {
+		d.sets = append(d.sets, SetOperation{field: path, value: ValueOfField(from)})
+		return nil
+	}
+	l, err := treeLiteral(v)
+	if err != nil {
+		return err
+	}
+	d.sets = append(d.sets, SetOperation{field: path, value: l})
+	return nil
+}
+
+// treeLiteral returns the literal for a JSON tree value
+func treeLiteral(v interface{}) (Literal, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return Literal{}, err
+	}
+	var l Literal
+	err = l.UnmarshalJSON(b)
+	return l, err
+}
+
+func (d *differ) object(prefix string, b, a map[string]interface{}) error {
+	for _, k := range sortedTreeKeys(a) {
+		path, err := diffPath(prefix, k)
+		if err != nil {
+			return err
+		}
+		bv, ok := b[k]
+		if !ok {
+			if err := d.set(path, a[k]); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.value(path, bv, a[k]); err != nil {
+			return err
+		}
+	}
+	for _, k := range sortedTreeKeys(b) {
+		if _, ok := a[k]; !ok {
+			path, err := diffPath(prefix, k)
+			if err != nil {
+				return err
+			}
+			d.unsets = append(d.unsets, UnsetOperation{field: path})
+		}
+	}
+	return nil
+}
+
+func (d *differ) value(path string, b, a interface{}) error {
+	if diffEqual(b, a) {
+		return nil
+	}
+	switch bv := b.(type) {
+	case map[string]interface{}:
+		if av, ok := a.(map[string]interface{}); ok {
+			return d.object(path, bv, av)
+		}
+	case []interface{}:
+		if av, ok := a.([]interface{}); ok {
+			return d.array(path, bv, av)
+		}
+	}
+	return d.set(path, a)
+}
+
+func (d *differ) array(path string, b, a []interface{}) error {
+	switch {
+	case len(a) > len(b) && diffEqual(b, a[:len(b)]):
+		values := make([]RValue, len(a)-len(b))
+		for i, v := range a[len(b):] {
+			l, err := treeLiteral(v)
+			if err != nil {
+				return err
+			}
+			values[i] = l
+		}
+		d.sets = append(d.sets, AppendOperation{field: path, values: values})
+		return nil
+	case len(a) < len(b):
+		if q, ok := removalQuery(b, a); ok {
+			f := ForEachOperation{field: path}
+			f.q.q = *q
+			f.u.isRemove = true
+			d.sets = append(d.sets, f)
+			return nil
+		}
+	case len(a) == len(b):
+		for i := range a {
+			if err := d.value(path+"."+strconv.Itoa(i), b[i], a[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return d.set(path, a)
+}
+
+// removalQuery returns a query selecting the elements of b that are
+// not in a, if a is b with some elements removed, and the query
+// selects exactly the removed elements
+func removalQuery(b, a []interface{}) (*Query, bool) {
+	// Match a as a subsequence of b
+	var removed []interface{}
+	keep := make([]bool, len(b))
+	j := 0
+	for i := range b {
+		if j < len(a) && diffEqual(b[i], a[j]) {
+			keep[i] = true
+			j++
+		} else {
+			removed = append(removed, b[i])
+		}
+	}
+	if j != len(a) {
+		return nil, false
+	}
+	var terms []*Query
+	for _, r := range removed {
+		q, ok := elementQuery(r)
+		if !ok {
+			return nil, false
+		}
+		terms = append(terms, q)
+	}
+	q := Simplify(OrList(terms))
+	// The query must select exactly the removed elements
+	tree, err := jsonTree(q)
+	if err != nil {
+		return nil, false
+	}
+	for i, e := range b {
+		match, err := eval.Matches(tree, e)
+		if err != nil || match == keep[i] {
+			return nil, false
+		}
+	}
+	return q, true
+}
+
+// elementQuery returns a query matching an array element: the element
+// itself for scalars, or its scalar fields for objects
+func elementQuery(e interface{}) (*Query, bool) {
+	switch x := e.(type) {
+	case []interface{}:
+		return nil, false
+	case map[string]interface{}:
+		var terms []*Query
+		for _, k := range sortedTreeKeys(x) {
+			if _, err := diffPath("", k); err != nil {
+				return nil, false
+			}
+			switch x[k].(type) {
+			case map[string]interface{}, []interface{}:
+				continue
+			}
+			l, err := treeLiteral(x[k])
+			if err != nil {
+				return nil, false
+			}
+			terms = append(terms, CmpValue(k, EQ, l))
+		}
+		switch len(terms) {
+		case 0:
+			return nil, false
+		case 1:
+			return terms[0], true
+		}
+		return AndList(terms), true
+	}
+	l, err := treeLiteral(e)
+	if err != nil {
+		return nil, false
+	}
+	return CmpValue("$this", EQ, l), true
+}
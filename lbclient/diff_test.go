@@ -0,0 +1,96 @@
+package lbclient
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func diffDoc(t *testing.T, s string) map[string]interface{} {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatalf("%s: %s", s, err)
+	}
+	return m
+}
+
+func TestDiffUpdate(t *testing.T) {
+	tests := []struct {
+		before, after, expected string
+	}{
+		{`{"a":1}`, `{"a":1}`, `[]`},
+		{`{"a":1,"b":"x"}`, `{"a":2,"c":true}`, `[{"$set":{"a":2}},{"$set":{"c":true}},{"$unset":"b"}]`},
+		{`{"o":{"x":1,"y":2}}`, `{"o":{"x":1,"y":3}}`, `{"$set":{"o.y":3}}`},
+		{`{"o":{"x":1}}`, `{"o":5}`, `{"$set":{"o":5}}`},
+		{`{"arr":[1,2]}`, `{"arr":[1,2,3,4]}`, `{"$append":{"arr":[3,4]}}`},
+		{`{"arr":[{"x":1},{"x":2}]}`, `{"arr":[{"x":1},{"x":3}]}`, `{"$set":{"arr.1.x":3}}`},
+		{`{"arr":[1,2,3]}`, `{"arr":[3]}`, `{"$foreach":{"$update":"$remove","arr":{"field":"$this","op":"$in","values":[1,2]}}}`},
+		{`{"arr":[{"id":1,"x":"a"},{"id":2,"x":"b"}]}`, `{"arr":[{"id":1,"x":"a"}]}`, `{"$foreach":{"$update":"$remove","arr":{"$and":[{"field":"id","op":"=","rvalue":2},{"field":"x","op":"=","rvalue":"b"}]}}}`},
+		{`{"arr":[[1],[2]]}`, `{"arr":[[2]]}`, `{"$set":{"arr":[[2]]}}`},
+		{`{"old":{"x":[1,2]}}`, `{"new":{"x":[1,2]}}`, `[{"$set":{"new":{"$valueof":"old"}}},{"$unset":"old"}]`},
+		{`{"n":1.5}`, `{"n":123456789012345678901234567890}`, `{"$set":{"n":123456789012345678901234567890}}`},
+	}
+	for _, test := range tests {
+		u, err := DiffUpdate(json.RawMessage(test.before), json.RawMessage(test.after))
+		if err != nil {
+			t.Errorf("%s -> %s: %s", test.before, test.after, err)
+			continue
+		}
+		b, _ := json.Marshal(u)
+		if string(b) != test.expected {
+			t.Errorf("%s -> %s: expected %s, got %s", test.before, test.after, test.expected, string(b))
+		}
+	}
+}
+
+func TestDiffUpdateApplies(t *testing.T) {
+	tests := []struct {
+		before, after string
+	}{
+		{`{"a":{"b":{"c":1,"d":[1,2]}},"e":null}`, `{"a":{"b":{"c":2,"d":[1,2,{"x":1}]}},"f":[]}`},
+		{`{"arr":[{"id":1,"x":"a"},{"id":2,"x":"b"},{"id":3,"x":"a"}]}`, `{"arr":[{"id":1,"x":"a"},{"id":3,"x":"a"}]}`},
+		{`{"arr":[1,2,1,3]}`, `{"arr":[1,1]}`},
+		{`{"arr":[1,2,1]}`, `{"arr":[2,1]}`},
+		{`{"arr":[[1],[2]]}`, `{"arr":[[2]]}`},
+		{`{"x":{"y":[1]},"z":1}`, `{"x":{"w":[1]},"z":"1"}`},
+	}
+	for _, test := range tests {
+		before, after := diffDoc(t, test.before), diffDoc(t, test.after)
+		u, err := DiffUpdate(before, after)
+		if err != nil {
+			t.Errorf("%s -> %s: %s", test.before, test.after, err)
+			continue
+		}
+		if err := u.Apply(before); err != nil {
+			t.Errorf("%s: %s", u, err)
+			continue
+		}
+		if !diffEqual(before, after) {
+			b, _ := json.Marshal(before)
+			t.Errorf("%s: expected %s, got %s", u, test.after, string(b))
+		}
+	}
+}
+
+func TestDiffUpdateStructs(t *testing.T) {
+	type doc struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags,omitempty"`
+		Date Date     `json:"date"`
+	}
+	before := doc{Name: "a"}
+	after := doc{Name: "b", Tags: []string{"x"}}
+	u, err := DiffUpdate(&before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(u)
+	if string(b) != `[{"$set":{"name":"b"}},{"$set":{"tags":["x"]}}]` {
+		t.Errorf("Wrong update: %s", string(b))
+	}
+	if _, err := DiffUpdate(1, after); err == nil {
+		t.Errorf("Expected error for non-document")
+	}
+	if _, err := DiffUpdate(map[string]interface{}{"a.b": 1}, map[string]interface{}{"a.b": 2}); err == nil {
+		t.Errorf("Expected error for field with dot")
+	}
+}
@@ -0,0 +1,167 @@
+package lbclient
+
+import (
+	"errors"
+)
+
+// Lightblue CRUD error codes
+const (
+	ERR_CRUD                    = "crud"
+	ERR_CRUD_NO_ACCESS          = "crud:NoAccess"
+	ERR_CRUD_NO_INSERT_ACCESS   = "crud:insert:NoFieldAccess"
+	ERR_CRUD_NO_UPDATE_ACCESS   = "crud:update:NoFieldAccess"
+	ERR_CRUD_REQUIRED           = "crud:Required"
+	ERR_CRUD_INVALID_ENTITY     = "crud:InvalidEntity"
+	ERR_CRUD_UNKNOWN_ENTITY     = "crud:UnknownEntity"
+	ERR_CRUD_CONCURRENT_UPDATE  = "crud:ConcurrentUpdate"
+	ERR_CRUD_DISABLED_METADATA  = "crud:DisabledMetadata"
+	ERR_CRUD_UNSUPPORTED_OP     = "crud:UnsupportedOperation"
+	ERR_REST_CRUD_FIND          = "rest-crud:FindError"
+	ERR_REST_CRUD_INSERT        = "rest-crud:InsertError"
+	ERR_REST_CRUD_UPDATE        = "rest-crud:UpdateError"
+	ERR_REST_CRUD_SAVE          = "rest-crud:SaveError"
+	ERR_REST_CRUD_DELETE        = "rest-crud:DeleteError"
+	ERR_REST_CRUD_NO_ACCESS     = "rest-crud:NoAccess"
+	ERR_REST_CRUD_CONCURRENT    = "rest-crud:ConcurrentUpdate"
+	ERR_REST_CRUD_LOCK          = "rest-crud:LockError"
+	ERR_REST_CRUD_NO_ENTITY     = "rest-crud:NoEntity"
+	ERR_REST_CRUD_INVALID_VER   = "rest-crud:InvalidVersion"
+	ERR_REST_CRUD_ILLEGAL_STATE = "rest-crud:IllegalState"
+)
+
+// Lightblue metadata error codes
+const (
+	ERR_METADATA_UNKNOWN_ENTITY       = "metadata:UnknownEntity"
+	ERR_METADATA_UNKNOWN_VERSION      = "metadata:UnknownVersion"
+	ERR_METADATA_DUPLICATE_ENTITY     = "metadata:DuplicateEntityInfo"
+	ERR_METADATA_DISABLED_VERSION     = "metadata:DisabledVersion"
+	ERR_METADATA_NO_ACCESS            = "metadata:NoAccess"
+	ERR_METADATA_PARSE_MISSING        = "metadata:ParseMissingElement"
+	ERR_MONGO_METADATA_DUPLICATE      = "mongo-metadata:DuplicateMetadata"
+	ERR_MONGO_METADATA_UNKNOWN_VER    = "mongo-metadata:UnknownVersion"
+	ERR_MONGO_METADATA_MISSING_ENTITY = "mongo-metadata:MissingEntityInfo"
+	ERR_MONGO_METADATA_DB_ERROR       = "mongo-metadata:DatabaseError"
+)
+
+// Lightblue mongo backend error codes
+const (
+	ERR_MONGO_DUPLICATE         = "mongo-crud:Duplicate"
+	ERR_MONGO_INSERTION         = "mongo-crud:InsertionError"
+	ERR_MONGO_SAVE              = "mongo-crud:SaveError"
+	ERR_MONGO_UPDATE            = "mongo-crud:UpdateError"
+	ERR_MONGO_DELETE            = "mongo-crud:DeleteError"
+	ERR_MONGO_NO_ACCESS         = "mongo-crud:NoAccess"
+	ERR_MONGO_CONCURRENT_UPDATE = "mongo-crud:ConcurrentUpdate"
+	ERR_MONGO_CONNECTION        = "mongo-crud:ConnectionError"
+	ERR_MONGO_DATABASE          = "mongo-crud:DatabaseError"
+	ERR_MONGO_TOO_MANY_RESULTS  = "mongo-crud:TooManyResults"
+)
+
+// Lightblue lock error codes
+const (
+	ERR_LOCK_INVALID   = "mongo-locking:InvalidLock"
+	ERR_LOCK_NOT_OWNED = "mongo-locking:LockNotOwned"
+	ERR_LOCK_TIMEOUT   = "mongo-locking:LockTimeout"
+)
+
+// Sentinel errors that classify lightblue errors. Use them with
+// errors.Is on a RequestError, or on errors wrapping RequestErrors
+// such as HTTPError
+var (
+	ErrDuplicate        = errors.New("duplicate document")
+	ErrConcurrentUpdate = errors.New("concurrent update")
+	ErrNoAccess         = errors.New("no access")
+	ErrEntityNotFound   = errors.New("entity not found")
+	ErrLock             = errors.New("lock error")
+)
+
+var errorClasses = map[string]error{
+	ERR_MONGO_DUPLICATE:               ErrDuplicate,
+	ERR_MONGO_METADATA_DUPLICATE:      ErrDuplicate,
+	ERR_METADATA_DUPLICATE_ENTITY:     ErrDuplicate,
+	ERR_CRUD_CONCURRENT_UPDATE:        ErrConcurrentUpdate,
+	ERR_REST_CRUD_CONCURRENT:          ErrConcurrentUpdate,
+	ERR_MONGO_CONCURRENT_UPDATE:       ErrConcurrentUpdate,
+	ERR_CRUD_NO_ACCESS:                ErrNoAccess,
+	ERR_CRUD_NO_INSERT_ACCESS:         ErrNoAccess,
+	ERR_CRUD_NO_UPDATE_ACCESS:         ErrNoAccess,
+	ERR_REST_CRUD_NO_ACCESS:           ErrNoAccess,
+	ERR_METADATA_NO_ACCESS:            ErrNoAccess,
+	ERR_MONGO_NO_ACCESS:               ErrNoAccess,
+	ERR_CRUD_UNKNOWN_ENTITY:           ErrEntityNotFound,
+	ERR_REST_CRUD_NO_ENTITY:           ErrEntityNotFound,
+	ERR_METADATA_UNKNOWN_ENTITY:       ErrEntityNotFound,
+	ERR_METADATA_UNKNOWN_VERSION:      ErrEntityNotFound,
+	ERR_MONGO_METADATA_UNKNOWN_VER:    ErrEntityNotFound,
+	ERR_MONGO_METADATA_MISSING_ENTITY: ErrEntityNotFound,
+	ERR_REST_CRUD_LOCK:                ErrLock,
+	ERR_LOCK_INVALID:                  ErrLock,
+	ERR_LOCK_NOT_OWNED:                ErrLock,
+	ERR_LOCK_TIMEOUT:                  ErrLock,
+}
+
+// Is returns true if target is the sentinel error for the error code
+// of r, so errors.Is(err, ErrDuplicate) can be used to classify errors
+func (r RequestError) Is(target error) bool {
+	if t, ok := target.(RequestError); ok {
+		return r.ErrorCode == t.ErrorCode
+	}
+	class, ok := errorClasses[r.ErrorCode]
+	return ok && class == target
+}
+
+// AllErrors returns all the errors of the response, including the
+// errors in DataErrors
+func (r *Response) AllErrors() []RequestError {
+	if r == nil {
+		return nil
+	}
+	ret := make([]RequestError, 0, len(r.Errors))
+	ret = append(ret, r.Errors...)
+	for _, d := range r.DataErrors {
+		ret = append(ret, d.Errors...)
+	}
+	return ret
+}
+
+// HasError returns true if any of the errors or data errors of the
+// response is target, as determined by errors.Is
+func (r *Response) HasError(target error) bool {
+	for _, e := range r.AllErrors() {
+		if errors.Is(e, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasErrorCode returns true if any of the errors or data errors of
+// the response has the given error code
+func (r *Response) HasErrorCode(code string) bool {
+	for _, e := range r.AllErrors() {
+		if e.ErrorCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDuplicate returns true if the response contains a duplicate document error
+func IsDuplicate(r *Response) bool {
+	return r.HasError(ErrDuplicate)
+}
+
+// IsConcurrentUpdate returns true if the response contains a concurrent update error
+func IsConcurrentUpdate(r *Response) bool {
+	return r.HasError(ErrConcurrentUpdate)
+}
+
+// IsNoAccess returns true if the response contains an access error
+func IsNoAccess(r *Response) bool {
+	return r.HasError(ErrNoAccess)
+}
+
+// IsEntityNotFound returns true if the response contains an unknown entity or version error
+func IsEntityNotFound(r *Response) bool {
+	return r.HasError(ErrEntityNotFound)
+}
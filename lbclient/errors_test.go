@@ -0,0 +1,34 @@
+package lbclient
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestErrorsIs(t *testing.T) {
+	err := RequestError{ErrorCode: ERR_MONGO_DUPLICATE}
+	if !errors.Is(err, ErrDuplicate) || errors.Is(err, ErrNoAccess) {
+		t.Errorf("Wrong classification for %s", err)
+	}
+	if !errors.Is(err, RequestError{ErrorCode: ERR_MONGO_DUPLICATE}) {
+		t.Errorf("Error code mismatch for %s", err)
+	}
+	var herr error = &HTTPError{StatusCode: 500, Errors: []RequestError{{ErrorCode: ERR_REST_CRUD_CONCURRENT}}}
+	if !errors.Is(herr, ErrConcurrentUpdate) {
+		t.Errorf("Wrong classification for %s", herr)
+	}
+}
+
+func TestResponseErrorHelpers(t *testing.T) {
+	r := Response{Errors: []RequestError{{ErrorCode: ERR_CRUD_NO_ACCESS}},
+		DataErrors: []DataError{{Errors: []RequestError{{ErrorCode: ERR_MONGO_DUPLICATE}}}}}
+	if !IsNoAccess(&r) || !IsDuplicate(&r) || IsConcurrentUpdate(&r) || IsEntityNotFound(&r) {
+		t.Errorf("Wrong classification for %s", &r)
+	}
+	if !r.HasErrorCode(ERR_MONGO_DUPLICATE) || r.HasErrorCode(ERR_MONGO_SAVE) {
+		t.Errorf("Wrong error codes for %s", &r)
+	}
+	if IsDuplicate(nil) {
+		t.Error("nil response has no errors")
+	}
+}
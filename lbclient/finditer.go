@@ -0,0 +1,160 @@
+package lbclient
+
+import (
+	"context"
+	"errors"
+	"reflect"
+)
+
+// FindIterator walks the resultset of a find request page by
+// page. Only one page of documents is kept in memory at a time. Use
+// it as:
+//
+//	it := client.FindIter(ctx, request, nil, 1000)
+//	for it.Next() {
+//	   doc := it.Value()
+//	   ...
+//	}
+//	if it.Err() != nil {
+//	   ...
+//	}
+type FindIterator struct {
+	ctx      context.Context
+	client   ContextDataServiceClient
+	request  FindRequest
+	dataType reflect.Type
+	pageSize int
+
+	// Next range start, and the last index of the requested range
+	from, to int
+	// Current page, and the index of the current document in page
+	page  reflect.Value
+	index int
+	// Set when the last page is retrieved
+	done       bool
+	matchCount int
+	err        error
+}
+
+// FindIter returns an iterator over the results of request, retrieving pageSize documents at a time
+func (c *HttpClient) FindIter(ctx context.Context, request *FindRequest, data interface{}, pageSize int) *FindIterator {
+	return NewFindIterator(ctx, c, request, data, pageSize)
+}
+
+// NewFindIterator returns an iterator over the results of request,
+// retrieving pageSize documents at a time from client. If the
+// request has a range, only that range of the resultset is
+// iterated.
+//
+//   - data If nil, documents are returned as map[string]interface{}.
+//     If data is a reflect.Type or any other value, the documents are
+//     unmarshaled into that type (or its element type, if it is a slice)
+func NewFindIterator(ctx context.Context, client ContextDataServiceClient, request *FindRequest, data interface{}, pageSize int) *FindIterator {
+	it := FindIterator{ctx: ctx, client: client, request: *request, pageSize: pageSize, index: -1, matchCount: -1}
+	if data != nil {
+		t, ok := data.(reflect.Type)
+		if !ok {
+			t = reflect.TypeOf(data)
+		}
+		if t.Kind() != reflect.Slice {
+			t = reflect.SliceOf(t)
+		}
+		it.dataType = t
+	}
+	if request.R != nil {
+		it.from, it.to = request.R.from, request.R.to
+	} else {
+		it.from, it.to = ALLRANGE.from, ALLRANGE.to
+	}
+	if pageSize <= 0 {
+		it.err = errors.New("Page size must be positive")
+	}
+	if it.to < it.from {
+		it.done = true
+	}
+	return &it
+}
+
+// Next advances the iterator to the next document, retrieving the
+// next page if necessary. Returns false when there are no more
+// documents, or if there is an error
+func (it *FindIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.page.IsValid() && it.index+1 < it.page.Len() {
+		it.index++
+		return true
+	}
+	for !it.done {
+		if err := it.fetch(); err != nil {
+			it.err = err
+			return false
+		}
+		if it.page.Len() > 0 {
+			it.index = 0
+			return true
+		}
+	}
+	return false
+}
+
+// Value returns the current document
+func (it *FindIterator) Value() interface{} {
+	if !it.page.IsValid() || it.index < 0 || it.index >= it.page.Len() {
+		return nil
+	}
+	return it.page.Index(it.index).Interface()
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *FindIterator) Err() error {
+	return it.err
+}
+
+// MatchCount returns the number of documents matching the query, as
+// reported by the server for the last page, or -1 if no page is
+// retrieved yet
+func (it *FindIterator) MatchCount() int {
+	return it.matchCount
+}
+
+func (it *FindIterator) fetch() error {
+	if err := it.ctx.Err(); err != nil {
+		return err
+	}
+	pageTo := it.from + it.pageSize - 1
+	if pageTo > it.to || pageTo < it.from {
+		pageTo = it.to
+	}
+	req := it.request
+	req.R = NewRange(it.from, pageTo)
+	var data interface{}
+	if it.dataType != nil {
+		data = it.dataType
+	}
+	resp, err := it.client.FindContext(it.ctx, &req, data)
+	if err != nil {
+		return err
+	}
+	if resp.Status == ERROR {
+		if len(resp.Errors) > 0 {
+			return resp.Errors[0]
+		}
+		return errors.New("Find failed")
+	}
+	it.matchCount = resp.MatchCount
+	if resp.EntityData == nil {
+		it.page = reflect.ValueOf([]interface{}{})
+	} else {
+		it.page = reflect.ValueOf(resp.EntityData)
+		if it.page.Kind() != reflect.Slice {
+			it.page = reflect.ValueOf([]interface{}{resp.EntityData})
+		}
+	}
+	it.from = pageTo + 1
+	if it.page.Len() < pageTo-req.R.from+1 || it.from > it.to || it.from >= resp.MatchCount {
+		it.done = true
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package lbclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type iterTestDoc struct {
+	Id int `json:"id"`
+}
+
+func pagingServer(t *testing.T, total int, calls *int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		var req struct {
+			Range []int `json:"range"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil || len(req.Range) != 2 {
+			t.Errorf("Bad request: %s", body)
+		}
+		docs := make([]map[string]interface{}, 0)
+		for i := req.Range[0]; i <= req.Range[1] && i < total; i++ {
+			docs = append(docs, map[string]interface{}{"id": i})
+		}
+		b, _ := json.Marshal(docs)
+		fmt.Fprintf(w, `{"status":"COMPLETE","matchCount":%d,"processed":%s}`, total, b)
+	}
+}
+
+func TestFindIter(t *testing.T) {
+	calls := 0
+	srv, cli := testServer(pagingServer(t, 25, &calls))
+	defer srv.Close()
+
+	it := cli.FindIter(context.Background(), &FindRequest{RequestHeader: RequestHeader{EntityName: "test"}}, reflect.TypeOf(iterTestDoc{}), 10)
+	n := 0
+	for it.Next() {
+		doc := it.Value().(iterTestDoc)
+		if doc.Id != n {
+			t.Errorf("Expected %d, got %d", n, doc.Id)
+		}
+		n++
+	}
+	if it.Err() != nil {
+		t.Error(it.Err())
+	}
+	if n != 25 || calls != 3 || it.MatchCount() != 25 {
+		t.Errorf("Expected 25 docs in 3 calls, got %d docs in %d calls", n, calls)
+	}
+}
+
+func TestFindIterRange(t *testing.T) {
+	calls := 0
+	srv, cli := testServer(pagingServer(t, 25, &calls))
+	defer srv.Close()
+
+	it := cli.FindIter(context.Background(), &FindRequest{RequestHeader: RequestHeader{EntityName: "test"}, R: NewRange(5, 14)}, nil, 4)
+	n := 5
+	for it.Next() {
+		doc := it.Value().(map[string]interface{})
+		if doc["id"].(float64) != float64(n) {
+			t.Errorf("Expected %d, got %v", n, doc["id"])
+		}
+		n++
+	}
+	if it.Err() != nil || n != 15 || calls != 3 {
+		t.Errorf("Unexpected result: %v %d %d", it.Err(), n, calls)
+	}
+}
+
+func TestFindIterCancel(t *testing.T) {
+	calls := 0
+	srv, cli := testServer(pagingServer(t, 25, &calls))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	it := cli.FindIter(ctx, &FindRequest{RequestHeader: RequestHeader{EntityName: "test"}}, nil, 10)
+	n := 0
+	for it.Next() {
+		n++
+		if n == 10 {
+			cancel()
+		}
+	}
+	if it.Err() != context.Canceled || n != 10 {
+		t.Errorf("Unexpected result: %v %d", it.Err(), n)
+	}
+}
@@ -2,9 +2,11 @@ package lbclient
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -61,8 +63,17 @@ type HttpClientConfig struct {
 	WriteConcern string
 	// Maximum query time
 	MaxQueryTimeMS int
-	// Execution options
+	// Default execution options. These are merged into the execution
+	// options of every data request, with ReadPreference, WriteConcern
+	// and MaxQueryTimeMS overriding the values given here, and the
+	// request execution options overriding both
 	ExecutionOptions interface{}
+	// Retry policy for failed calls. If nil, calls are not retried
+	RetryPolicy *RetryPolicy
+	// If true, Find requests without a projection that are given a
+	// struct result type use ProjectionFor the result type, so only
+	// the fields of the struct are retrieved
+	AutoProjection bool
 }
 
 // HttpClient can be initialised once, and shared by multiple threads
@@ -101,22 +112,69 @@ func NewHttpClient(config *HttpClientConfig) *HttpClient {
 
 // Call performs an HTTP method on the url, and returns the result
 func (c *HttpClient) Call(url *url.URL, httpMethod string, body []byte) ([]byte, error) {
-	req, err := http.NewRequest(httpMethod, url.String(), bytes.NewReader(body))
+	return c.CallContext(context.Background(), url, httpMethod, body)
+}
+
+// CallContext performs an HTTP method on the url using ctx, and
+// returns the result. If ctx is cancelled or its deadline expires
+// before the call completes, the returned error is ctx.Err(), so it
+// can be compared to context.Canceled or context.DeadlineExceeded.
+// If the response status is not 2xx, or if the response is not JSON,
+// the returned error is an *HTTPError. Only GET calls are retried
+// under the retry policy, unless the policy allows retrying
+// non-idempotent calls
+func (c *HttpClient) CallContext(ctx context.Context, url *url.URL, httpMethod string, body []byte) ([]byte, error) {
+	return c.call(ctx, url, httpMethod, body, httpMethod == GET)
+}
+
+// call performs the HTTP call, retrying it under the configured
+// retry policy
+func (c *HttpClient) call(ctx context.Context, url *url.URL, httpMethod string, body []byte, idempotent bool) ([]byte, error) {
+	policy := c.Config.RetryPolicy
+	for n := 1; ; n++ {
+		attempt := c.attempt(ctx, url, httpMethod, body)
+		attempt.Attempt = n
+		if !policy.shouldRetry(attempt, idempotent) {
+			if attempt.Err != nil {
+				return nil, attempt.Err
+			}
+			if err := checkResponse(attempt); err != nil {
+				return nil, err
+			}
+			return attempt.Body, nil
+		}
+		if err := sleep(ctx, policy.Backoff(n)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt performs a single HTTP call
+func (c *HttpClient) attempt(ctx context.Context, url *url.URL, httpMethod string, body []byte) *CallAttempt {
+	req, err := http.NewRequestWithContext(ctx, httpMethod, url.String(), bytes.NewReader(body))
 	if err != nil {
-		return nil, err
+		return &CallAttempt{Err: err}
 	}
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Accept", "application/json")
 	resp, err := c.Client.Do(req)
 	if err != nil {
-		return nil, err
+		return &CallAttempt{Err: ctxErr(ctx, err)}
 	}
 	defer resp.Body.Close()
 	rdbody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return &CallAttempt{StatusCode: resp.StatusCode, Header: resp.Header, Err: ctxErr(ctx, err)}
+	}
+	return &CallAttempt{StatusCode: resp.StatusCode, Header: resp.Header, Body: rdbody}
+}
+
+// ctxErr returns ctx.Err() if the context is done, otherwise err
+func ctxErr(ctx context.Context, err error) error {
+	if ctxerr := ctx.Err(); ctxerr != nil {
+		return ctxerr
 	}
-	return rdbody, nil
+	return err
 }
 
 type marshalResponse struct {
@@ -128,10 +186,10 @@ type marshalResponse struct {
 	MatchCount     int      `json:"matchCount"`
 	TaskHandle     string
 	Session        string
-	ResultMetadata []map[string]interface{} `json:"resultMetadata"`
-	DataErrors     []map[string]interface{} `json:"dataErrors"`
-	Errors         []map[string]interface{} `json:"errors"`
-	EntityData     interface{}              `json:"processed"`
+	ResultMetadata []ResultMd     `json:"resultMetadata"`
+	DataErrors     []DataError    `json:"dataErrors"`
+	Errors         []RequestError `json:"errors"`
+	EntityData     interface{}    `json:"processed"`
 }
 
 // DataCall performs a data service call
@@ -146,7 +204,19 @@ type marshalResponse struct {
 // Returns the response, and if there is an error or not. If returnDataType is a struct, then
 // the JSON documents are unmarshaled to that type. Othrwise, the documents are returned
 // as a slice/map tree
+//
+// The default execution options of the client are merged into the
+// execution options of body, as for the other data calls.
+//
+// If the response status is not 2xx and the body is a lightblue JSON
+// response, the decoded response is returned together with the
+// *HTTPError
 func (c *HttpClient) DataCall(entityName, entityVersion string, body []byte, returnDataType reflect.Type, operation CrudOperation, httpMethod string) (*Response, error) {
+	return c.DataCallContext(context.Background(), entityName, entityVersion, body, returnDataType, operation, httpMethod)
+}
+
+// DataCallContext performs a data service call using ctx. See DataCall.
+func (c *HttpClient) DataCallContext(ctx context.Context, entityName, entityVersion string, body []byte, returnDataType reflect.Type, operation CrudOperation, httpMethod string) (*Response, error) {
 	b := bytes.Buffer{}
 	b.WriteString(c.Config.DataServiceURI)
 	if c.Config.DataServiceURI[len(c.Config.DataServiceURI)-1] != '/' {
@@ -163,11 +233,26 @@ func (c *HttpClient) DataCall(entityName, entityVersion string, body []byte, ret
 	if err != nil {
 		panic("Invalid URI:" + b.String())
 	}
-	responseBody, err := c.Call(url, httpMethod, body)
+	if body, err = c.withExecutionDefaults(body); err != nil {
+		return nil, err
+	}
+	responseBody, err := c.call(ctx, url, httpMethod, body, operation == CRUD_FIND)
 	if err != nil {
+		// A non-2xx lightblue response is returned with the error
+		if herr, ok := err.(*HTTPError); ok && len(herr.Errors) > 0 {
+			if resp, derr := DecodeResponse(herr.jsonBody, returnDataType); derr == nil {
+				herr.Response = resp
+				return resp, err
+			}
+		}
 		return nil, err
 	}
+	return DecodeResponse(responseBody, returnDataType)
+}
 
+// DecodeResponse decodes a data service response body. The
+// documents are decoded using returnDataType, as described in DataCall
+func DecodeResponse(responseBody []byte, returnDataType reflect.Type) (*Response, error) {
 	var mr marshalResponse
 	singleResult := false
 	if returnDataType != nil {
@@ -178,7 +263,7 @@ func (c *HttpClient) DataCall(entityName, entityVersion string, body []byte, ret
 			mr.EntityData = reflect.New(returnDataType).Interface()
 		}
 	}
-	err = json.Unmarshal(responseBody, &mr)
+	err := json.Unmarshal(responseBody, &mr)
 	if err != nil {
 		return nil, err
 	}
@@ -191,9 +276,15 @@ func (c *HttpClient) DataCall(entityName, entityVersion string, body []byte, ret
 	response.MatchCount = mr.MatchCount
 	response.TaskHandle = mr.TaskHandle
 	response.Session = mr.Session
-	response.Errors = unmarshalErrors(mr.Errors)
-	response.DataErrors = unmarshalDataErrors(mr.DataErrors)
-	response.ResultMetadata = unmarshalRmd(mr.ResultMetadata)
+	if len(mr.Errors) > 0 {
+		response.Errors = mr.Errors
+	}
+	if len(mr.DataErrors) > 0 {
+		response.DataErrors = mr.DataErrors
+	}
+	if len(mr.ResultMetadata) > 0 {
+		response.ResultMetadata = mr.ResultMetadata
+	}
 	if mr.EntityData != nil {
 		t, ok := mr.EntityData.([]map[string]interface{})
 		if ok {
@@ -209,7 +300,9 @@ func (c *HttpClient) DataCall(entityName, entityVersion string, body []byte, ret
 				if edValue.Len() > 1 {
 					return nil, errors.New("More than one results for a non-array resultset")
 				}
-				response.EntityData = edValue.Index(0).Interface()
+				if edValue.Len() == 1 {
+					response.EntityData = edValue.Index(0).Interface()
+				}
 			} else {
 				response.EntityData = ed
 			}
@@ -218,68 +311,121 @@ func (c *HttpClient) DataCall(entityName, entityVersion string, body []byte, ret
 	return &response, nil
 }
 
-func unmarshalErrors(errors []map[string]interface{}) []RequestError {
-	if errors == nil || len(errors) == 0 {
-		return nil
-	}
-	ret := make([]RequestError, len(errors))
-	for i, err := range errors {
-		ret[i] = UnmarshalError(err)
-	}
-	return ret
+// UnmarshalError converts an error object decoded as a map into a RequestError
+func UnmarshalError(error map[string]interface{}) (RequestError, error) {
+	var ret RequestError
+	err := remarshal(error, &ret)
+	return ret, err
 }
 
-func UnmarshalError(error map[string]interface{}) RequestError {
-	return RequestError{Context: error["context"].(string),
-		ErrorCode: error["errorCode"].(string),
-		Msg:       error["msg"].(string)}
+// UnmarshalDataError converts a data error object decoded as a map into a DataError
+func UnmarshalDataError(error map[string]interface{}) (DataError, error) {
+	var ret DataError
+	err := remarshal(error, &ret)
+	return ret, err
 }
 
-func unmarshalDataErrors(errors []map[string]interface{}) []DataError {
-	if errors == nil || len(errors) == 0 {
-		return nil
-	}
-	ret := make([]DataError, len(errors))
-	for i, err := range errors {
-		ret[i] = UnmarshalDataError(err)
+// UnmarshalRmd converts a result metadata object decoded as a map into a ResultMd
+func UnmarshalRmd(r map[string]interface{}) (ResultMd, error) {
+	var ret ResultMd
+	err := remarshal(r, &ret)
+	return ret, err
+}
+
+// remarshal converts a map to a struct by marshaling the map and unmarshaling it into out
+func remarshal(m map[string]interface{}, out interface{}) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
 	}
-	return ret
+	return json.Unmarshal(b, out)
 }
 
-func UnmarshalDataError(error map[string]interface{}) DataError {
-	return DataError{Errors: unmarshalErrors(error["errors"].([]map[string]interface{})),
-		EntityData: error["entityData"].([]map[string]interface{})}
+// defaultExecutionOptions returns the execution options configured
+// for the client as a map, or nil if there are none
+func (c *HttpClient) defaultExecutionOptions() (map[string]interface{}, error) {
+	ret := make(map[string]interface{})
+	if c.Config.ExecutionOptions != nil {
+		if err := mergeJSON(ret, c.Config.ExecutionOptions); err != nil {
+			return nil, err
+		}
+	}
+	opts := MongoExecutionOptions{ReadPref: ReadPreference(c.Config.ReadPreference),
+		WriteConcern: c.Config.WriteConcern,
+		MaxQueryTime: c.Config.MaxQueryTimeMS}
+	if err := mergeJSON(ret, opts); err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, nil
+	}
+	return ret, nil
 }
 
-func unmarshalRmd(rmd []map[string]interface{}) []ResultMd {
-	if rmd == nil || len(rmd) == 0 {
-		return nil
+// mergeJSON marshals v, which must marshal to a JSON object, and
+// copies its fields into m
+func mergeJSON(m map[string]interface{}, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var x map[string]interface{}
+	if err := json.Unmarshal(b, &x); err != nil {
+		return errors.New("Execution options must be a JSON object:" + err.Error())
 	}
-	ret := make([]ResultMd, len(rmd))
-	for i, r := range rmd {
-		ret[i] = UnmarshalRmd(r)
+	for k, v := range x {
+		m[k] = v
 	}
-	return ret
+	return nil
 }
 
-func UnmarshalRmd(r map[string]interface{}) ResultMd {
-	return ResultMd{DocumentVersion: r["documentVersion"].(string)}
+// withExecutionDefaults returns the JSON request body with the
+// default execution options of the client merged into the execution
+// options of the request. An empty body is returned as is
+func (c *HttpClient) withExecutionDefaults(body []byte) ([]byte, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return body, nil
+	}
+	defaults, err := c.defaultExecutionOptions()
+	if err != nil || defaults == nil {
+		return body, err
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, err
+	}
+	if x, ok := m["execution"]; ok {
+		if err := mergeJSON(defaults, x); err != nil {
+			return nil, err
+		}
+	}
+	if m["execution"], err = json.Marshal(defaults); err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
 }
 
-func (c *HttpClient) docCall(request interface{}, data interface{}, entityName, entityVersion string, op CrudOperation, mth string) (*Response, error) {
+func (c *HttpClient) docCall(ctx context.Context, request interface{}, data interface{}, entityName, entityVersion string, op CrudOperation, mth string) (*Response, error) {
 	body, err := json.Marshal(request)
 	if err != nil {
 		return nil, err
 	}
-	var t reflect.Type
-	if data != nil {
-		var ok bool
-		t, ok = data.(reflect.Type)
-		if !ok {
-			t = reflect.TypeOf(data)
-		}
+	return c.DataCallContext(ctx, entityName, entityVersion, body, ReturnDataType(data), op, mth)
+}
+
+// ReturnDataType returns the type documents are decoded into for
+// the data argument of Find, Insert, Save and Update. If data is
+// nil, returns nil. If data is a reflect.Type, returns data,
+// otherwise returns the type of data
+func ReturnDataType(data interface{}) reflect.Type {
+	if data == nil {
+		return nil
 	}
-	return c.DataCall(entityName, entityVersion, body, t, op, mth)
+	t, ok := data.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(data)
+	}
+	return t
 }
 
 // Find issues a find request to the server
@@ -290,7 +436,19 @@ func (c *HttpClient) docCall(request interface{}, data interface{}, entityName,
 //     of that type. If data is any other struct, then the result documents will be
 //     unmarshaled of that type
 func (c *HttpClient) Find(request *FindRequest, data interface{}) (*Response, error) {
-	return c.docCall(request, data, request.EntityName, request.EntityVersion, CRUD_FIND, POST)
+	return c.FindContext(context.Background(), request, data)
+}
+
+// FindContext is Find using ctx
+func (c *HttpClient) FindContext(ctx context.Context, request *FindRequest, data interface{}) (*Response, error) {
+	if request.P == nil && c.Config.AutoProjection {
+		if p := ProjectionFor(ReturnDataType(data)); p != nil {
+			r := *request
+			r.P = p
+			request = &r
+		}
+	}
+	return c.docCall(ctx, request, data, request.EntityName, request.EntityVersion, CRUD_FIND, POST)
 }
 
 // Insert adds documents to a database
@@ -299,7 +457,12 @@ func (c *HttpClient) Find(request *FindRequest, data interface{}) (*Response, er
 //   * returnData This can be JSON marshalable object (or array of such objects), or
 //     a map[string]interface{} (or an array of it)
 func (c *HttpClient) Insert(request *InsertRequest, returnData interface{}) (*Response, error) {
-	return c.docCall(request, returnData, request.EntityName, request.EntityVersion, CRUD_INSERT, PUT)
+	return c.InsertContext(context.Background(), request, returnData)
+}
+
+// InsertContext is Insert using ctx
+func (c *HttpClient) InsertContext(ctx context.Context, request *InsertRequest, returnData interface{}) (*Response, error) {
+	return c.docCall(ctx, request, returnData, request.EntityName, request.EntityVersion, CRUD_INSERT, PUT)
 }
 
 // Save adds/updates documents in a database
@@ -308,7 +471,12 @@ func (c *HttpClient) Insert(request *InsertRequest, returnData interface{}) (*Re
 //   * returnData This can be JSON marshalable object (or array of such objects), or
 //     a map[string]interface{} (or an array of it)
 func (c *HttpClient) Save(request *SaveRequest, returnData interface{}) (*Response, error) {
-	return c.docCall(request, returnData, request.EntityName, request.EntityVersion, CRUD_SAVE, POST)
+	return c.SaveContext(context.Background(), request, returnData)
+}
+
+// SaveContext is Save using ctx
+func (c *HttpClient) SaveContext(ctx context.Context, request *SaveRequest, returnData interface{}) (*Response, error) {
+	return c.docCall(ctx, request, returnData, request.EntityName, request.EntityVersion, CRUD_SAVE, POST)
 }
 
 // Update modifies documents in a database
@@ -317,18 +485,28 @@ func (c *HttpClient) Save(request *SaveRequest, returnData interface{}) (*Respon
 //   * returnData This can be JSON marshalable object (or array of such objects), or
 //     a map[string]interface{} (or an array of it)
 func (c *HttpClient) Update(request *UpdateRequest, returnData interface{}) (*Response, error) {
-	return c.docCall(request, returnData, request.EntityName, request.EntityVersion, CRUD_UPDATE, POST)
+	return c.UpdateContext(context.Background(), request, returnData)
+}
+
+// UpdateContext is Update using ctx
+func (c *HttpClient) UpdateContext(ctx context.Context, request *UpdateRequest, returnData interface{}) (*Response, error) {
+	return c.docCall(ctx, request, returnData, request.EntityName, request.EntityVersion, CRUD_UPDATE, POST)
 }
 
 // Delete removes documents from a database
 //
 //   * request The delete request
 func (c *HttpClient) Delete(request *DeleteRequest) (*Response, error) {
+	return c.DeleteContext(context.Background(), request)
+}
+
+// DeleteContext is Delete using ctx
+func (c *HttpClient) DeleteContext(ctx context.Context, request *DeleteRequest) (*Response, error) {
 	body, err := json.Marshal(request)
 	if err != nil {
 		return nil, err
 	}
-	return c.DataCall(request.EntityName, request.EntityVersion, body, nil, CRUD_DELETE, POST)
+	return c.DataCallContext(ctx, request.EntityName, request.EntityVersion, body, nil, CRUD_DELETE, POST)
 }
 
 func buildLockRequest(operation, domain, callerId, resourceId string) map[string]string {
@@ -338,7 +516,7 @@ func buildLockRequest(operation, domain, callerId, resourceId string) map[string
 		"resourceId": resourceId}
 }
 
-func (c *HttpClient) lock(req map[string]string) ([]byte, error) {
+func (c *HttpClient) lock(ctx context.Context, req map[string]string) ([]byte, error) {
 	b := bytes.Buffer{}
 	b.WriteString(c.Config.DataServiceURI)
 	if c.Config.DataServiceURI[len(c.Config.DataServiceURI)-1] != '/' {
@@ -350,30 +528,48 @@ func (c *HttpClient) lock(req map[string]string) ([]byte, error) {
 		panic("Invalid URI:" + b.String())
 	}
 	body, _ := json.Marshal(req)
-	return c.Call(url, POST, body)
+	return c.call(ctx, url, POST, body, true)
 }
 
 func parseLockResult(body []byte, err error) (string, error) {
-	if err == nil {
-		var resultMap map[string]interface{}
-		err = json.Unmarshal(body, &resultMap)
-		if err == nil {
-			if resultMap["status"] == "ERROR" {
-				return "", UnmarshalError(resultMap["errors"].([]map[string]interface{})[0])
-			} else {
-				return resultMap["result"].(string), nil
-			}
-		}
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Status OpStatus       `json:"status"`
+		Result interface{}    `json:"result"`
+		Errors []RequestError `json:"errors"`
+	}
+	if err = json.Unmarshal(body, &result); err != nil {
+		return "", err
+	}
+	if len(result.Errors) > 0 {
+		return "", result.Errors[0]
+	}
+	if result.Status == ERROR {
+		return "", errors.New("Lock call failed")
+	}
+	switch r := result.Result.(type) {
+	case string:
+		return r, nil
+	case nil:
+		return "", errors.New("Missing lock result")
+	default:
+		return fmt.Sprint(r), nil
 	}
-	return "", err
 }
 
 func (c *HttpClient) Acquire(domain, callerId, resourceId string, ttl int) (bool, error) {
+	return c.AcquireContext(context.Background(), domain, callerId, resourceId, ttl)
+}
+
+// AcquireContext is Acquire using ctx
+func (c *HttpClient) AcquireContext(ctx context.Context, domain, callerId, resourceId string, ttl int) (bool, error) {
 	req := buildLockRequest("acquire", domain, callerId, resourceId)
 	if ttl > 0 {
 		req["ttl"] = strconv.Itoa(ttl)
 	}
-	res, err := parseLockResult(c.lock(req))
+	res, err := parseLockResult(c.lock(ctx, req))
 	if err == nil {
 		return res == "true", nil
 	} else {
@@ -382,7 +578,12 @@ func (c *HttpClient) Acquire(domain, callerId, resourceId string, ttl int) (bool
 }
 
 func (c *HttpClient) Release(domain, callerId, resourceId string) (bool, error) {
-	res, err := parseLockResult(c.lock(buildLockRequest("release", domain, callerId, resourceId)))
+	return c.ReleaseContext(context.Background(), domain, callerId, resourceId)
+}
+
+// ReleaseContext is Release using ctx
+func (c *HttpClient) ReleaseContext(ctx context.Context, domain, callerId, resourceId string) (bool, error) {
+	res, err := parseLockResult(c.lock(ctx, buildLockRequest("release", domain, callerId, resourceId)))
 	if err == nil {
 		return res == "true", nil
 	} else {
@@ -391,7 +592,12 @@ func (c *HttpClient) Release(domain, callerId, resourceId string) (bool, error)
 }
 
 func (c *HttpClient) GetLockCount(domain, callerId, resourceId string) (int, error) {
-	res, err := parseLockResult(c.lock(buildLockRequest("count", domain, callerId, resourceId)))
+	return c.GetLockCountContext(context.Background(), domain, callerId, resourceId)
+}
+
+// GetLockCountContext is GetLockCount using ctx
+func (c *HttpClient) GetLockCountContext(ctx context.Context, domain, callerId, resourceId string) (int, error) {
+	res, err := parseLockResult(c.lock(ctx, buildLockRequest("count", domain, callerId, resourceId)))
 	if err == nil {
 		return strconv.Atoi(res)
 	} else {
@@ -400,7 +606,12 @@ func (c *HttpClient) GetLockCount(domain, callerId, resourceId string) (int, err
 }
 
 func (c *HttpClient) Ping(domain, callerId, resourceId string) (bool, error) {
-	res, err := parseLockResult(c.lock(buildLockRequest("ping", domain, callerId, resourceId)))
+	return c.PingContext(context.Background(), domain, callerId, resourceId)
+}
+
+// PingContext is Ping using ctx
+func (c *HttpClient) PingContext(ctx context.Context, domain, callerId, resourceId string) (bool, error) {
+	res, err := parseLockResult(c.lock(ctx, buildLockRequest("ping", domain, callerId, resourceId)))
 	if err == nil {
 		return res == "true", nil
 	} else {
@@ -0,0 +1,189 @@
+package lbclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var _ ContextDataServiceClient = &HttpClient{}
+var _ ContextLockingClient = &HttpClient{}
+
+// jsonHandler sets the response content type to JSON before calling handler
+func jsonHandler(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		handler(w, r)
+	}
+}
+
+func testServer(handler http.HandlerFunc) (*httptest.Server, *HttpClient) {
+	srv := httptest.NewServer(jsonHandler(handler))
+	cli := NewHttpClient(&HttpClientConfig{DataServiceURI: srv.URL})
+	return srv, cli
+}
+
+func TestFindContextCancel(t *testing.T) {
+	done := make(chan struct{})
+	srv, cli := testServer(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	})
+	defer srv.Close()
+	defer close(done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := cli.FindContext(ctx, &FindRequest{RequestHeader: RequestHeader{EntityName: "test"}}, nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestFindContext(t *testing.T) {
+	srv, cli := testServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/find/test/1.0.0" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"status":"COMPLETE","matchCount":1,"processed":[{"a":1}]}`))
+	})
+	defer srv.Close()
+
+	resp, err := cli.FindContext(context.Background(), &FindRequest{RequestHeader: RequestHeader{EntityName: "test", EntityVersion: "1.0.0"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != COMPLETE || resp.MatchCount != 1 {
+		t.Errorf("Unexpected response: %s", resp)
+	}
+}
+
+func TestLockContextCancel(t *testing.T) {
+	srv, cli := testServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result":"true"}`))
+	})
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := cli.AcquireContext(ctx, "d", "c", "r", 0)
+	if err != context.Canceled {
+		t.Errorf("Expected cancelled, got %v", err)
+	}
+	ok, err := cli.AcquireContext(context.Background(), "d", "c", "r", 0)
+	if err != nil || !ok {
+		t.Errorf("Expected acquired, got %t %v", ok, err)
+	}
+}
+
+func TestHTTPError(t *testing.T) {
+	srv, cli := testServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("<html>Unauthorized</html>"))
+	})
+	defer srv.Close()
+
+	_, err := cli.Find(&FindRequest{RequestHeader: RequestHeader{EntityName: "test"}}, nil)
+	herr, ok := err.(*HTTPError)
+	if !ok || herr.StatusCode != http.StatusUnauthorized || string(herr.Body) != "<html>Unauthorized</html>" ||
+		herr.Header.Get("Content-Type") != "text/html" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestHTTPErrorNotJSON(t *testing.T) {
+	srv, cli := testServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(strings.Repeat("x", MaxHTTPErrorBody*2)))
+	})
+	defer srv.Close()
+
+	_, err := cli.Find(&FindRequest{RequestHeader: RequestHeader{EntityName: "test"}}, nil)
+	herr, ok := err.(*HTTPError)
+	if !ok || herr.StatusCode != http.StatusOK || len(herr.Body) != MaxHTTPErrorBody {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestHTTPErrorLightblueErrors(t *testing.T) {
+	srv, cli := testServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status":"ERROR","errors":[{"objectType":"error","context":"find","errorCode":"crud:NoAccess","msg":"no"}]}`))
+	})
+	defer srv.Close()
+
+	_, err := cli.Find(&FindRequest{RequestHeader: RequestHeader{EntityName: "test"}}, nil)
+	var rerr RequestError
+	if !errors.As(err, &rerr) || rerr.ErrorCode != "crud:NoAccess" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if herr, ok := err.(*HTTPError); !ok || herr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func executionServer(t *testing.T, execution *map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		*execution, _ = req["execution"].(map[string]interface{})
+		w.Write([]byte(`{"status":"COMPLETE"}`))
+	}
+}
+
+func TestDefaultExecutionOptions(t *testing.T) {
+	var execution map[string]interface{}
+	srv, cli := testServer(executionServer(t, &execution))
+	defer srv.Close()
+
+	cli.Find(&FindRequest{RequestHeader: RequestHeader{EntityName: "test"}}, nil)
+	if execution != nil {
+		t.Errorf("Unexpected execution options: %v", execution)
+	}
+
+	cli.Config.ExecutionOptions = MongoExecutionOptions{ReadPref: PRIMARY, MaxQueryTime: 100}
+	cli.Config.ReadPreference = string(SECONDARY)
+	cli.Config.WriteConcern = "majority"
+	cli.Find(&FindRequest{RequestHeader: RequestHeader{EntityName: "test"}}, nil)
+	if len(execution) != 3 || execution["readPreference"] != "secondary" || execution["writeConcern"] != "majority" ||
+		execution["maxQueryTimeMS"] != float64(100) {
+		t.Errorf("Unexpected execution options: %v", execution)
+	}
+
+	cli.Delete(&DeleteRequest{RequestHeader: RequestHeader{EntityName: "test",
+		ExecutionOptions: MongoExecutionOptions{ReadPref: NEAREST, MaxQueryTime: 5}}, Q: CmpValue("a", EQ, LitInt(1))})
+	if len(execution) != 3 || execution["readPreference"] != "nearest" || execution["writeConcern"] != "majority" ||
+		execution["maxQueryTimeMS"] != float64(5) {
+		t.Errorf("Unexpected execution options: %v", execution)
+	}
+
+	cli.DataCall("test", "", []byte(`{"execution":{"maxQueryTimeMS":7}}`), nil, CRUD_FIND, POST)
+	if len(execution) != 3 || execution["readPreference"] != "secondary" || execution["maxQueryTimeMS"] != float64(7) {
+		t.Errorf("Unexpected execution options: %v", execution)
+	}
+}
+
+func TestHTTPErrorResponse(t *testing.T) {
+	srv, cli := testServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status":"ERROR","modifiedCount":0,"errors":[{"objectType":"error","context":"c","errorCode":"mongo-crud:Duplicate","msg":"x"}]}`))
+	})
+	defer srv.Close()
+
+	resp, err := cli.Insert(&InsertRequest{RequestHeader: RequestHeader{EntityName: "test"}}, nil)
+	herr, ok := err.(*HTTPError)
+	if !ok || herr.StatusCode != http.StatusBadRequest || herr.Response != resp {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp == nil || resp.Status != ERROR || !IsDuplicate(resp) || !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Unexpected response: %v", resp)
+	}
+}
@@ -0,0 +1,111 @@
+package lbclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// MaxHTTPErrorBody is the maximum number of bytes of the response
+// body kept in an HTTPError
+var MaxHTTPErrorBody = 1024
+
+// HTTPError is returned when the server responds with a non-2xx
+// status, or with a body that is not JSON. If the body is a lightblue
+// error document, the errors in it are decoded into Errors.
+type HTTPError struct {
+	StatusCode int
+	Header     http.Header
+	// The response body, truncated to MaxHTTPErrorBody bytes
+	Body []byte
+	// Errors decoded from a lightblue JSON error document, if any
+	Errors []RequestError
+	// Response is the lightblue response decoded from the body of a
+	// data service call, if the body is a JSON lightblue response. It
+	// is also returned by the data call, so the response helpers such
+	// as IsDuplicate can be used
+	Response *Response
+
+	// The complete JSON body
+	jsonBody []byte
+}
+
+func (e *HTTPError) Error() string {
+	if len(e.Errors) > 0 {
+		return fmt.Sprintf("HTTP %d: %s", e.StatusCode, e.Errors[0])
+	}
+	return fmt.Sprintf("HTTP %d: %s", e.StatusCode, string(e.Body))
+}
+
+// Unwrap returns the lightblue errors contained in the response, so
+// errors.As can be used to extract a RequestError
+func (e *HTTPError) Unwrap() []error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	ret := make([]error, len(e.Errors))
+	for i, x := range e.Errors {
+		ret[i] = x
+	}
+	return ret
+}
+
+// isJSON returns true if the content type is a JSON media type
+func isJSON(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// checkResponse returns an HTTPError if the response status is not
+// 2xx, or if the response is not JSON
+func checkResponse(attempt *CallAttempt) error {
+	contentType := attempt.Header.Get("Content-Type")
+	ok2xx := attempt.StatusCode >= 200 && attempt.StatusCode < 300
+	if ok2xx && (isJSON(contentType) || (len(contentType) == 0 && len(attempt.Body) == 0)) {
+		return nil
+	}
+	ret := HTTPError{StatusCode: attempt.StatusCode, Header: attempt.Header}
+	if len(attempt.Body) > MaxHTTPErrorBody {
+		ret.Body = attempt.Body[:MaxHTTPErrorBody]
+	} else {
+		ret.Body = attempt.Body
+	}
+	if isJSON(contentType) {
+		ret.Errors = decodeErrorDocument(attempt.Body)
+		ret.jsonBody = attempt.Body
+	}
+	return &ret
+}
+
+// decodeErrorDocument decodes the errors in a lightblue response, or
+// in a single lightblue error object
+func decodeErrorDocument(body []byte) []RequestError {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return nil
+	}
+	var doc struct {
+		Errors     []RequestError `json:"errors"`
+		DataErrors []DataError    `json:"dataErrors"`
+	}
+	if json.Unmarshal(trimmed, &doc) != nil {
+		return nil
+	}
+	ret := doc.Errors
+	for _, d := range doc.DataErrors {
+		ret = append(ret, d.Errors...)
+	}
+	if len(ret) == 0 {
+		var single RequestError
+		if json.Unmarshal(trimmed, &single) == nil && len(single.ErrorCode) > 0 {
+			ret = []RequestError{single}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,175 @@
+package lbclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// metadataURI builds the metadata service URI from path segments
+func (c *HttpClient) metadataURI(segments ...string) (*url.URL, error) {
+	if len(c.Config.MetadataServiceURI) == 0 {
+		return nil, errors.New("MetadataServiceURI is not configured")
+	}
+	b := bytes.Buffer{}
+	b.WriteString(c.Config.MetadataServiceURI)
+	for _, s := range segments {
+		if b.Bytes()[b.Len()-1] != '/' {
+			b.WriteRune('/')
+		}
+		b.WriteString(s)
+	}
+	url, err := url.Parse(b.String())
+	if err != nil {
+		return nil, errors.New("Invalid URI:" + b.String())
+	}
+	return url, nil
+}
+
+// metadataCall calls the metadata service, and unmarshals the result
+// into out, if out is not nil. If the service returns an error
+// document, it is returned as a RequestError
+func (c *HttpClient) metadataCall(ctx context.Context, uri *url.URL, httpMethod string, request interface{}, out interface{}) error {
+	var body []byte
+	if request != nil {
+		var err error
+		body, err = json.Marshal(request)
+		if err != nil {
+			return err
+		}
+	}
+	responseBody, err := c.call(ctx, uri, httpMethod, body, httpMethod == GET)
+	if err != nil {
+		return err
+	}
+	if err = metadataError(responseBody); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(responseBody, out)
+}
+
+// metadataError returns the error contained in a metadata service
+// response, or nil if the response is not an error
+func metadataError(body []byte) error {
+	if errs := decodeErrorDocument(body); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// GetEntityNames returns the entity names, optionally filtered by status
+func (c *HttpClient) GetEntityNames(ctx context.Context, statuses ...MetadataStatus) ([]string, error) {
+	segment := ""
+	if len(statuses) > 0 {
+		s := make([]string, len(statuses))
+		for i, x := range statuses {
+			s[i] = string(x)
+		}
+		segment = "s=" + strings.Join(s, ",")
+	}
+	uri, err := c.metadataURI(segment)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Entities []string `json:"entities"`
+	}
+	if err := c.metadataCall(ctx, uri, GET, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Entities, nil
+}
+
+// GetEntityVersions returns the versions of an entity
+func (c *HttpClient) GetEntityVersions(ctx context.Context, entityName string) ([]EntityVersion, error) {
+	uri, err := c.metadataURI(url.PathEscape(entityName))
+	if err != nil {
+		return nil, err
+	}
+	var result []EntityVersion
+	if err := c.metadataCall(ctx, uri, GET, nil, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetMetadata returns the metadata for the given entity version
+func (c *HttpClient) GetMetadata(ctx context.Context, entityName, version string) (*EntityMetadata, error) {
+	return c.metadataResult(ctx, GET, nil, url.PathEscape(entityName), url.PathEscape(version))
+}
+
+// metadataResult calls the metadata service URI built from the path
+// segments, and returns the resulting metadata
+func (c *HttpClient) metadataResult(ctx context.Context, httpMethod string, request interface{}, segments ...string) (*EntityMetadata, error) {
+	uri, err := c.metadataURI(segments...)
+	if err != nil {
+		return nil, err
+	}
+	return c.metadataResultURI(ctx, uri, httpMethod, request)
+}
+
+func (c *HttpClient) metadataResultURI(ctx context.Context, uri *url.URL, httpMethod string, request interface{}) (*EntityMetadata, error) {
+	var md EntityMetadata
+	if err := c.metadataCall(ctx, uri, httpMethod, request, &md); err != nil {
+		return nil, err
+	}
+	return &md, nil
+}
+
+// CreateMetadata creates a new entity. The entity name and version
+// are taken from the schema
+func (c *HttpClient) CreateMetadata(ctx context.Context, md *EntityMetadata) (*EntityMetadata, error) {
+	if len(md.Schema.Name) == 0 || len(md.Schema.Version.Value) == 0 {
+		return nil, errors.New("Schema name and version are required")
+	}
+	return c.metadataResult(ctx, PUT, md, url.PathEscape(md.Schema.Name), url.PathEscape(md.Schema.Version.Value))
+}
+
+// CreateSchema creates a new version for an existing entity. The
+// entity name and version are taken from the schema
+func (c *HttpClient) CreateSchema(ctx context.Context, schema *EntitySchema) (*EntityMetadata, error) {
+	if len(schema.Name) == 0 || len(schema.Version.Value) == 0 {
+		return nil, errors.New("Schema name and version are required")
+	}
+	return c.metadataResult(ctx, PUT, schema, url.PathEscape(schema.Name), "schema="+url.PathEscape(schema.Version.Value))
+}
+
+// UpdateEntityInfo updates the entity info of an entity
+func (c *HttpClient) UpdateEntityInfo(ctx context.Context, info *EntityInfo) (*EntityMetadata, error) {
+	if len(info.Name) == 0 {
+		return nil, errors.New("Entity name is required")
+	}
+	return c.metadataResult(ctx, PUT, info, url.PathEscape(info.Name))
+}
+
+// UpdateSchemaStatus changes the status of an entity version
+func (c *HttpClient) UpdateSchemaStatus(ctx context.Context, entityName, version string, status MetadataStatus, comment string) (*EntityMetadata, error) {
+	uri, err := c.metadataURI(url.PathEscape(entityName), url.PathEscape(version), url.PathEscape(string(status)))
+	if err != nil {
+		return nil, err
+	}
+	if len(comment) > 0 {
+		uri.RawQuery = url.Values{"comment": []string{comment}}.Encode()
+	}
+	return c.metadataResultURI(ctx, uri, PUT, nil)
+}
+
+// SetDefaultVersion sets the default version of an entity
+func (c *HttpClient) SetDefaultVersion(ctx context.Context, entityName, version string) (*EntityMetadata, error) {
+	return c.metadataResult(ctx, POST, nil, url.PathEscape(entityName), url.PathEscape(version), "default")
+}
+
+// RemoveEntity removes an entity, including all its versions
+func (c *HttpClient) RemoveEntity(ctx context.Context, entityName string) error {
+	uri, err := c.metadataURI(url.PathEscape(entityName))
+	if err != nil {
+		return err
+	}
+	return c.metadataCall(ctx, uri, DELETE, nil, nil)
+}
@@ -0,0 +1,139 @@
+package lbclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var _ MetadataClient = &HttpClient{}
+
+func testMetadataServer(handler http.HandlerFunc) (*httptest.Server, *HttpClient) {
+	srv := httptest.NewServer(jsonHandler(handler))
+	cli := NewHttpClient(&HttpClientConfig{MetadataServiceURI: srv.URL + "/metadata"})
+	return srv, cli
+}
+
+func TestGetEntityNames(t *testing.T) {
+	srv, cli := testMetadataServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata/":
+			w.Write([]byte(`{"entities":["a","b"]}`))
+		case "/metadata/s=active,disabled":
+			w.Write([]byte(`{"entities":["a"]}`))
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	})
+	defer srv.Close()
+
+	names, err := cli.GetEntityNames(context.Background())
+	if err != nil || len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("Unexpected result: %v %v", names, err)
+	}
+	names, err = cli.GetEntityNames(context.Background(), ACTIVE, DISABLED)
+	if err != nil || len(names) != 1 || names[0] != "a" {
+		t.Errorf("Unexpected result: %v %v", names, err)
+	}
+}
+
+func TestGetMetadata(t *testing.T) {
+	srv, cli := testMetadataServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != GET || r.URL.Path != "/metadata/user/1.0.0" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`{"entityInfo":{"name":"user","defaultVersion":"1.0.0","datastore":{"backend":"mongo"}},
+"schema":{"name":"user","version":{"value":"1.0.0","changelog":"init"},"status":{"value":"active"},"fields":{"x":{"type":"string"}}}}`))
+	})
+	defer srv.Close()
+
+	md, err := cli.GetMetadata(context.Background(), "user", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.EntityInfo.Name != "user" || md.EntityInfo.DefaultVersion != "1.0.0" ||
+		md.Schema.Version.Value != "1.0.0" || md.Schema.Status.Value != ACTIVE ||
+		string(md.Schema.Fields) != `{"x":{"type":"string"}}` {
+		t.Errorf("Unexpected result: %+v", md)
+	}
+}
+
+func TestMetadataUnknownFields(t *testing.T) {
+	srv, cli := testMetadataServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case GET:
+			w.Write([]byte(`{"entityInfo":{"name":"user","entityConstraints":[{"x":1}]},
+"schema":{"name":"user","version":{"value":"1.0.0"},"status":{"value":"active"},"custom":"c"}}`))
+		case PUT:
+			body, _ := ioutil.ReadAll(r.Body)
+			if string(body) != `{"defaultVersion":"1.0.0","entityConstraints":[{"x":1}],"name":"user"}` {
+				t.Errorf("Unexpected body: %s", string(body))
+			}
+			w.Write([]byte(`{"entityInfo":` + string(body) + `}`))
+		}
+	})
+	defer srv.Close()
+
+	md, err := cli.GetMetadata(context.Background(), "user", "1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.EntityInfo.Extra()["entityConstraints"] == nil || md.Schema.Extra()["custom"] != "c" {
+		t.Errorf("Unexpected extra fields: %v %v", md.EntityInfo.Extra(), md.Schema.Extra())
+	}
+	md.EntityInfo.DefaultVersion = "1.0.0"
+	if _, err := cli.UpdateEntityInfo(context.Background(), &md.EntityInfo); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateSchemaStatus(t *testing.T) {
+	srv, cli := testMetadataServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != PUT || r.URL.Path != "/metadata/user/1.0.0/deprecated" || r.URL.Query().Get("comment") != "old" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+		}
+		w.Write([]byte(`{"entityInfo":{"name":"user"},"schema":{"name":"user","version":{"value":"1.0.0"},"status":{"value":"deprecated"}}}`))
+	})
+	defer srv.Close()
+
+	md, err := cli.UpdateSchemaStatus(context.Background(), "user", "1.0.0", DEPRECATED, "old")
+	if err != nil || md.Schema.Status.Value != DEPRECATED {
+		t.Errorf("Unexpected result: %+v %v", md, err)
+	}
+}
+
+func TestCreateMetadataError(t *testing.T) {
+	srv, cli := testMetadataServer(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != PUT || r.URL.Path != "/metadata/user/1.0.0" || len(body) == 0 {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`{"objectType":"error","context":"rest/PutEntityMetadata","errorCode":"metadata:DuplicateEntityInfo","msg":"user"}`))
+	})
+	defer srv.Close()
+
+	var md EntityMetadata
+	md.EntityInfo.Name = "user"
+	md.Schema.Name = "user"
+	md.Schema.Version.Value = "1.0.0"
+	_, err := cli.CreateMetadata(context.Background(), &md)
+	rerr, ok := err.(RequestError)
+	if !ok || rerr.ErrorCode != "metadata:DuplicateEntityInfo" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestMetadataNotConfigured(t *testing.T) {
+	cli := NewHttpClient(&HttpClientConfig{DataServiceURI: "http://localhost/data"})
+	if _, err := cli.GetEntityNames(context.Background()); err == nil {
+		t.Error("Expected error")
+	}
+	if _, err := cli.UpdateSchemaStatus(context.Background(), "user", "1.0.0", ACTIVE, "c"); err == nil {
+		t.Error("Expected error")
+	}
+	if err := cli.RemoveEntity(context.Background(), "user"); err == nil {
+		t.Error("Expected error")
+	}
+}
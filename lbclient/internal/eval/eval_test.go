@@ -0,0 +1,130 @@
+package eval
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func parse(t *testing.T, s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("%s: %s", s, err)
+	}
+	return v
+}
+
+func TestMatches(t *testing.T) {
+	doc := parse(t, `{"name":"john","age":30,"tags":["a","b"],"addr":[{"city":"x","zip":1},{"city":"y","zip":2}],"nick":"JOHN","created":"2017-01-15T13:11:15Z"}`)
+	tests := []struct {
+		q        string
+		expected bool
+	}{
+		{`{"field":"name","op":"=","rvalue":"john"}`, true},
+		{`{"field":"age","op":">","rvalue":29}`, true},
+		{`{"field":"age","op":"<","rvalue":29}`, false},
+		{`{"field":"missing","op":"=","rvalue":null}`, true},
+		{`{"field":"missing","op":"!=","rvalue":1}`, true},
+		{`{"field":"age","op":"$in","values":[1,30]}`, true},
+		{`{"field":"age","op":"$nin","values":[1,30]}`, false},
+		{`{"field":"name","regex":"^J","caseInsensitive":true}`, true},
+		{`{"field":"name","regex":"^J"}`, false},
+		{`{"field":"name","regex":"j o h n","extended":true}`, true},
+		{`{"array":"tags","contains":"$any","values":["a","z"]}`, true},
+		{`{"array":"tags","contains":"$all","values":["a","z"]}`, false},
+		{`{"array":"tags","contains":"$none","values":["z"]}`, true},
+		{`{"array":"addr","elemMatch":{"$and":[{"field":"city","op":"=","rvalue":"y"},{"field":"zip","op":"=","rvalue":2}]}}`, true},
+		{`{"array":"addr","elemMatch":{"$and":[{"field":"city","op":"=","rvalue":"y"},{"field":"zip","op":"=","rvalue":1}]}}`, false},
+		{`{"$or":[{"field":"age","op":"=","rvalue":1},{"field":"name","op":"=","rvalue":"john"}]}`, true},
+		{`{"$not":{"field":"age","op":"=","rvalue":30}}`, false},
+		{`{"field":"addr.*.city","op":"=","rvalue":"y"}`, true},
+		{`{"field":"addr.0.city","op":"=","rvalue":"y"}`, false},
+		{`{"field":"name","op":"!=","rfield":"nick"}`, true},
+		{`{"field":"created","op":"=","rvalue":"20170115T14:11:15.000+0100"}`, true},
+		{`{"field":"created","op":"<","rvalue":"20170115T13:11:16.000+0000"}`, true},
+	}
+	for _, x := range tests {
+		r, err := Matches(parse(t, x.q), doc)
+		if err != nil {
+			t.Errorf("%s: %s", x.q, err)
+		} else if r != x.expected {
+			t.Errorf("%s: expected %t", x.q, x.expected)
+		}
+	}
+	if _, err := Matches(parse(t, `{"foo":1}`), doc); err == nil {
+		t.Error("Expected error for invalid query")
+	}
+	if r, err := Matches(parse(t, `{"$not":{"foo":1}}`), doc); r || err == nil {
+		t.Errorf("Expected false with an error for invalid $not, got %t %v", r, err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	doc := parse(t, `{"name":"john","age":30,"tags":["a","b"],"addr":[{"city":"x","zip":1},{"city":"y","zip":2}]}`).(map[string]interface{})
+	update := parse(t, `[{"$set":{"name":"jack","obj.x":{"$valueof":"age"}}},{"$add":{"age":1}},{"$unset":"tags.0"},
+{"$append":{"tags":["c"]}},{"$insert":{"tags.0":["z"]}},
+{"$foreach":{"addr":{"field":"city","op":"=","rvalue":"x"},"$update":"$remove"}},
+{"$foreach":{"addr":"$all","$update":{"$set":{"zip":{"$valueof":"city"}}}}}]`)
+	if err := Apply(update, doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := parse(t, `{"name":"jack","age":31,"obj":{"x":30},"tags":["z","b","c"],"addr":[{"city":"y","zip":"y"}]}`)
+	if !equal(doc, expected) {
+		b, _ := json.Marshal(doc)
+		t.Errorf("Unexpected result: %s", b)
+	}
+}
+
+func TestProject(t *testing.T) {
+	doc := parse(t, `{"_id":"1","name":"john","age":30,"addr":[{"city":"x","zip":1},{"city":"y","zip":2}],"obj":{"a":1,"b":2}}`).(map[string]interface{})
+	tests := []struct {
+		p, expected string
+	}{
+		{`{"field":"*","include":true,"recursive":true}`, `{"_id":"1","name":"john","age":30,"addr":[{"city":"x","zip":1},{"city":"y","zip":2}],"obj":{"a":1,"b":2}}`},
+		{`[{"field":"name","include":true},{"field":"obj.a","include":true}]`, `{"name":"john","obj":{"a":1}}`},
+		{`[{"field":"*","include":true,"recursive":true},{"field":"obj","include":false,"recursive":true}]`, `{"_id":"1","name":"john","age":30,"addr":[{"city":"x","zip":1},{"city":"y","zip":2}]}`},
+		{`{"field":"obj","include":false}`, `{"_id":"1","name":"john","age":30,"addr":[{"city":"x","zip":1},{"city":"y","zip":2}]}`},
+		{`{"field":"addr.*.city","include":true}`, `{"addr":[{"city":"x"},{"city":"y"}]}`},
+		{`{"field":"addr","include":true,"range":[1,1]}`, `{"addr":[{"city":"y","zip":2}]}`},
+		{`{"field":"addr","include":true,"range":[1,null]}`, `{"addr":[{"city":"y","zip":2}]}`},
+		{`{"field":"addr","include":true,"match":{"field":"zip","op":"=","rvalue":1},"projection":{"field":"city","include":true}}`, `{"addr":[{"city":"x"}]}`},
+	}
+	for _, x := range tests {
+		r, err := Project(parse(t, x.p), doc)
+		if err != nil {
+			t.Errorf("%s: %s", x.p, err)
+		} else if !equal(r, parse(t, x.expected)) {
+			b, _ := json.Marshal(r)
+			t.Errorf("%s: expected %s, got %s", x.p, x.expected, b)
+		}
+	}
+}
+
+func TestProjectInvalidRange(t *testing.T) {
+	doc := parse(t, `{"addr":[{"city":"x"},{"city":"y"}]}`).(map[string]interface{})
+	for _, p := range []string{
+		`{"field":"addr","include":true,"range":["x",1]}`,
+		`{"field":"addr","include":true,"range":[null,1]}`,
+		`{"field":"addr","include":true,"range":[0,"y"]}`,
+		`{"field":"addr","include":true,"range":[0.5,1]}`,
+		`{"field":"addr","include":true,"range":[0]}`,
+	} {
+		if _, err := Project(parse(t, p), doc); err == nil {
+			t.Errorf("%s: expected error", p)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	docs := []map[string]interface{}{
+		parse(t, `{"a":2,"b":"x"}`).(map[string]interface{}),
+		parse(t, `{"a":1,"b":"y"}`).(map[string]interface{}),
+		parse(t, `{"a":2,"b":"z"}`).(map[string]interface{}),
+		parse(t, `{"b":"w"}`).(map[string]interface{}),
+	}
+	if err := Sort(parse(t, `[{"a":"$desc"},{"b":"$asc"}]`), docs); err != nil {
+		t.Fatal(err)
+	}
+	if docs[0]["b"] != "x" || docs[1]["b"] != "z" || docs[2]["b"] != "y" || docs[3]["b"] != "w" {
+		t.Errorf("Unexpected order: %v", docs)
+	}
+}
@@ -0,0 +1,87 @@
+// Package eval evaluates lightblue query, projection, sort and update
+// expressions on documents. Expressions and documents are JSON trees,
+// as produced by encoding/json when unmarshaling into interface{}.
+package eval
+
+import (
+	"strconv"
+	"strings"
+)
+
+// node is a value in a document, with a link to its parent so
+// relative field references can be resolved
+type node struct {
+	value  interface{}
+	parent *node
+}
+
+// splitPath splits a field path into its segments
+func splitPath(path string) []string {
+	if len(path) == 0 {
+		return nil
+	}
+	return strings.Split(path, ".")
+}
+
+// resolve returns the nodes reached by following path from n. A
+// path can contain array indexes, * to match all array elements,
+// $parent to move to the parent node, and $this to refer to the
+// node itself. Missing fields are not included in the result
+func resolve(n *node, path string) []*node {
+	cur := []*node{n}
+	for _, seg := range splitPath(path) {
+		var next []*node
+		for _, c := range cur {
+			switch seg {
+			case "$this":
+				next = append(next, c)
+			case "$parent":
+				if c.parent != nil {
+					next = append(next, c.parent)
+				}
+			case "*":
+				if arr, ok := c.value.([]interface{}); ok {
+					for _, e := range arr {
+						next = append(next, &node{value: e, parent: c})
+					}
+				}
+			default:
+				switch v := c.value.(type) {
+				case map[string]interface{}:
+					if x, ok := v[seg]; ok {
+						next = append(next, &node{value: x, parent: c})
+					}
+				case []interface{}:
+					if i, ok := index(seg, len(v)); ok && i < len(v) {
+						next = append(next, &node{value: v[i], parent: c})
+					}
+				}
+			}
+		}
+		cur = next
+	}
+	return cur
+}
+
+// hasWildcard returns true if path contains a * segment
+func hasWildcard(path string) bool {
+	for _, s := range splitPath(path) {
+		if s == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// index parses an array index. Negative indexes count from the end
+// of an array of length n
+func index(seg string, n int) (int, bool) {
+	i, err := strconv.Atoi(seg)
+	if err != nil {
+		return 0, false
+	}
+	if i < 0 {
+		i += n
+	}
+	return i, i >= 0
+}
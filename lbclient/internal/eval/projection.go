@@ -0,0 +1,375 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+)
+
+// projectionPart is a parsed projection expression
+type projectionPart struct {
+	field     []string
+	include   bool
+	recursive bool
+	// Array projections
+	isArray bool
+	// rng is the inclusive index range, or nil. A null upper bound is
+	// stored as math.MaxInt64
+	rng     *[2]int64
+	match   interface{}
+	sort    interface{}
+	project interface{}
+}
+
+func parseProjection(projection interface{}) ([]projectionPart, error) {
+	var list []interface{}
+	switch p := projection.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		list = p
+	default:
+		list = []interface{}{p}
+	}
+	ret := make([]projectionPart, 0, len(list))
+	for _, x := range list {
+		m, ok := x.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Invalid projection: %v", x)
+		}
+		field, ok := m["field"].(string)
+		if !ok {
+			return nil, fmt.Errorf("Invalid projection field: %v", x)
+		}
+		part := projectionPart{field: splitPath(field), include: m["include"] != false}
+		part.recursive, _ = m["recursive"].(bool)
+		if r, ok := m["range"]; ok {
+			part.isArray = true
+			rng, err := parseRange(r)
+			if err != nil {
+				return nil, err
+			}
+			part.rng = rng
+		}
+		if q, ok := m["match"]; ok {
+			part.isArray = true
+			part.match = q
+		}
+		part.sort = m["sort"]
+		part.project = m["projection"]
+		ret = append(ret, part)
+	}
+	return ret, nil
+}
+
+// parseRange parses a [from, to] range. from must be an integer, and
+// to an integer or null
+func parseRange(r interface{}) (*[2]int64, error) {
+	bounds, ok := r.([]interface{})
+	if !ok || len(bounds) != 2 {
+		return nil, fmt.Errorf("Invalid range: %v", r)
+	}
+	rng := &[2]int64{0, math.MaxInt64}
+	for i, b := range bounds {
+		if b == nil && i == 1 {
+			continue
+		}
+		n, ok := number(b)
+		if !ok || !n.IsInt() {
+			return nil, fmt.Errorf("Invalid range bound: %v", b)
+		}
+		var acc big.Accuracy
+		if rng[i], acc = n.Int64(); acc != big.Exact {
+			return nil, fmt.Errorf("Invalid range bound: %v", b)
+		}
+	}
+	return rng, nil
+}
+
+// matchesPath returns true if the pattern matches the path exactly
+func matchesPath(pattern, path []string) bool {
+	if len(pattern) != len(path) {
+		return false
+	}
+	for i := range pattern {
+		if pattern[i] != "*" && pattern[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// decide returns the projection part that determines the inclusion
+// of the path, or nil if there is none. Later parts override earlier
+// ones
+func decide(parts []projectionPart, path []string) *projectionPart {
+	for i := len(parts) - 1; i >= 0; i-- {
+		p := &parts[i]
+		if matchesPath(p.field, path) {
+			return p
+		}
+		if p.recursive && len(p.field) < len(path) && matchesPath(p.field, path[:len(p.field)]) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Project applies a projection to a document, and returns the
+// projected copy. A nil projection returns a copy of the document
+func Project(projection interface{}, doc map[string]interface{}) (map[string]interface{}, error) {
+	parts, err := parseProjection(projection)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return DeepCopy(doc), nil
+	}
+	// If there are no inclusions, everything not excluded is included
+	defaultInclude := true
+	for _, p := range parts {
+		if p.include {
+			defaultInclude = false
+		}
+	}
+	v, keep, err := project(parts, doc, nil, defaultInclude)
+	if err != nil {
+		return nil, err
+	}
+	if !keep {
+		return map[string]interface{}{}, nil
+	}
+	return v.(map[string]interface{}), nil
+}
+
+// project projects value at path. Returns the projected value, and
+// whether the value should be kept
+func project(parts []projectionPart, value interface{}, path []string, inherited bool) (interface{}, bool, error) {
+	include := inherited
+	explicit := false
+	if len(path) > 0 {
+		if p := decide(parts, path); p != nil {
+			if p.isArray && matchesPath(p.field, path) {
+				return projectArray(p, value)
+			}
+			include = p.include
+			explicit = true
+			if p.recursive || !p.include {
+				return deepCopyIf(value, include), include, nil
+			}
+		}
+	}
+	switch t := value.(type) {
+	case map[string]interface{}:
+		ret := make(map[string]interface{})
+		for k, v := range t {
+			x, keep, err := project(parts, v, append(path[:len(path):len(path)], k), inheritFor(include, explicit))
+			if err != nil {
+				return nil, false, err
+			}
+			if keep {
+				ret[k] = x
+			}
+		}
+		return ret, include || len(ret) > 0, nil
+	case []interface{}:
+		ret := make([]interface{}, 0, len(t))
+		for _, v := range t {
+			x, keep, err := project(parts, v, append(path[:len(path):len(path)], "*"), inheritFor(include, explicit))
+			if err != nil {
+				return nil, false, err
+			}
+			if keep {
+				ret = append(ret, x)
+			}
+		}
+		return ret, include || len(ret) > 0, nil
+	}
+	return value, include, nil
+}
+
+// inheritFor returns the default inclusion for the children of a
+// node. A non-recursive explicit inclusion does not include children
+func inheritFor(include, explicit bool) bool {
+	if explicit {
+		return false
+	}
+	return include
+}
+
+func deepCopyIf(v interface{}, b bool) interface{} {
+	if b {
+		return deepCopy(v)
+	}
+	return nil
+}
+
+// projectArray applies an array range or match projection
+func projectArray(p *projectionPart, value interface{}) (interface{}, bool, error) {
+	arr, ok := value.([]interface{})
+	if !ok {
+		return nil, false, nil
+	}
+	elements := make([]interface{}, len(arr))
+	copy(elements, arr)
+	if p.sort != nil {
+		if err := sortValues(p.sort, elements); err != nil {
+			return nil, false, err
+		}
+	}
+	selected := make([]bool, len(elements))
+	for i, e := range elements {
+		if p.rng != nil {
+			selected[i] = int64(i) >= p.rng[0] && int64(i) <= p.rng[1]
+		} else {
+			m, err := Matches(p.match, e)
+			if err != nil {
+				return nil, false, err
+			}
+			selected[i] = m
+		}
+	}
+	nested, err := parseProjection(p.project)
+	if err != nil {
+		return nil, false, err
+	}
+	ret := make([]interface{}, 0, len(elements))
+	for i, e := range elements {
+		if selected[i] != p.include {
+			continue
+		}
+		if len(nested) > 0 {
+			x, keep, err := project(nested, e, nil, false)
+			if err != nil {
+				return nil, false, err
+			}
+			if keep {
+				ret = append(ret, x)
+			}
+		} else {
+			ret = append(ret, deepCopy(e))
+		}
+	}
+	return ret, true, nil
+}
+
+// sortKey is a parsed sort key
+type sortKey struct {
+	field      string
+	descending bool
+}
+
+func parseSort(s interface{}) ([]sortKey, error) {
+	var list []interface{}
+	switch t := s.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		list = t
+	default:
+		list = []interface{}{t}
+	}
+	ret := make([]sortKey, 0, len(list))
+	for _, x := range list {
+		m, ok := x.(map[string]interface{})
+		if !ok || len(m) != 1 {
+			return nil, fmt.Errorf("Invalid sort key: %v", x)
+		}
+		for k, v := range m {
+			switch v {
+			case "$asc":
+				ret = append(ret, sortKey{field: k})
+			case "$desc":
+				ret = append(ret, sortKey{field: k, descending: true})
+			default:
+				return nil, fmt.Errorf("Invalid sort direction: %v", v)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// compareForSort orders values so that nulls and missing values come
+// first, and incomparable values are ordered by type
+func compareForSort(a, b interface{}) int {
+	if c, ok := compare(a, b); ok {
+		return c
+	}
+	return typeRank(a) - typeRank(b)
+}
+
+func typeRank(v interface{}) int {
+	if v == nil {
+		return 0
+	}
+	if _, ok := number(v); ok {
+		return 1
+	}
+	switch v.(type) {
+	case string:
+		return 2
+	case bool:
+		return 3
+	case map[string]interface{}:
+		return 4
+	}
+	return 5
+}
+
+// comparator returns a function comparing two values using the sort expression
+func comparator(s interface{}) (func(a, b interface{}) int, error) {
+	keys, err := parseSort(s)
+	if err != nil {
+		return nil, err
+	}
+	first := func(v interface{}, field string) interface{} {
+		nodes := resolve(&node{value: v}, field)
+		if len(nodes) == 0 {
+			return nil
+		}
+		return nodes[0].value
+	}
+	return func(a, b interface{}) int {
+		for _, k := range keys {
+			c := compareForSort(first(a, k.field), first(b, k.field))
+			if k.descending {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	}, nil
+}
+
+// Comparator returns a function that compares two documents using
+// the sort expression
+func Comparator(s interface{}) (func(a, b map[string]interface{}) int, error) {
+	cmp, err := comparator(s)
+	if err != nil {
+		return nil, err
+	}
+	return func(a, b map[string]interface{}) int { return cmp(a, b) }, nil
+}
+
+// sortValues sorts values using the sort expression
+func sortValues(s interface{}, values []interface{}) error {
+	cmp, err := comparator(s)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(values, func(i, j int) bool { return cmp(values[i], values[j]) < 0 })
+	return nil
+}
+
+// Sort sorts the documents using the sort expression
+func Sort(s interface{}, docs []map[string]interface{}) error {
+	cmp, err := Comparator(s)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(docs, func(i, j int) bool { return cmp(docs[i], docs[j]) < 0 })
+	return nil
+}
@@ -0,0 +1,320 @@
+package eval
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Matches evaluates a query against a document. The query is the
+// JSON representation of a lightblue query expression. A nil query
+// matches all documents
+func Matches(query interface{}, doc interface{}) (bool, error) {
+	if query == nil {
+		return true, nil
+	}
+	return matches(query, &node{value: doc})
+}
+
+func matches(query interface{}, ctx *node) (bool, error) {
+	q, ok := query.(map[string]interface{})
+	if !ok {
+		return false, fmt.Errorf("Invalid query: %v", query)
+	}
+	if x, ok := q["$and"]; ok {
+		return logical(x, ctx, true)
+	}
+	if x, ok := q["$or"]; ok {
+		return logical(x, ctx, false)
+	}
+	if x, ok := q["$any"]; ok {
+		return logical(x, ctx, false)
+	}
+	if x, ok := q["$all"]; ok {
+		return logical(x, ctx, true)
+	}
+	if x, ok := q["$not"]; ok {
+		r, err := matches(x, ctx)
+		if err != nil {
+			return false, err
+		}
+		return !r, nil
+	}
+	if arr, ok := q["array"]; ok {
+		field, ok := arr.(string)
+		if !ok {
+			return false, fmt.Errorf("Invalid array: %v", arr)
+		}
+		if em, ok := q["elemMatch"]; ok {
+			return elemMatch(field, em, ctx)
+		}
+		return arrayContains(field, q, ctx)
+	}
+	f, ok := q["field"]
+	if !ok {
+		return false, fmt.Errorf("Invalid query: %v", query)
+	}
+	field, ok := f.(string)
+	if !ok {
+		return false, fmt.Errorf("Invalid field: %v", f)
+	}
+	if pattern, ok := q["regex"]; ok {
+		return regex(field, pattern, q, ctx)
+	}
+	op, ok := q["op"].(string)
+	if !ok {
+		return false, fmt.Errorf("Invalid operator: %v", q["op"])
+	}
+	if v, ok := q["rvalue"]; ok {
+		return compareValues(fieldValues(ctx, field), op, []interface{}{v})
+	}
+	if v, ok := q["values"]; ok {
+		values, ok := v.([]interface{})
+		if !ok {
+			return false, fmt.Errorf("Invalid values: %v", v)
+		}
+		return compareValues(fieldValues(ctx, field), op, values)
+	}
+	if v, ok := q["rfield"]; ok {
+		rfield, ok := v.(string)
+		if !ok {
+			return false, fmt.Errorf("Invalid rfield: %v", v)
+		}
+		rvalues := fieldValues(ctx, rfield)
+		if isNary(op) {
+			// The rfield is an array, compare with its elements
+			var elements []interface{}
+			for _, r := range rvalues {
+				if arr, ok := r.([]interface{}); ok {
+					elements = append(elements, arr...)
+				} else if r != nil {
+					elements = append(elements, r)
+				}
+			}
+			rvalues = elements
+		}
+		return compareValues(fieldValues(ctx, field), op, rvalues)
+	}
+	return false, fmt.Errorf("Invalid comparison: %v", query)
+}
+
+// logical evaluates $and (all=true) and $or (all=false)
+func logical(x interface{}, ctx *node, all bool) (bool, error) {
+	list, ok := x.([]interface{})
+	if !ok {
+		return false, fmt.Errorf("Invalid query list: %v", x)
+	}
+	for _, q := range list {
+		r, err := matches(q, ctx)
+		if err != nil {
+			return false, err
+		}
+		if r != all {
+			return r, nil
+		}
+	}
+	return all, nil
+}
+
+// fieldValues returns the values of a field. A missing field is
+// returned as a single null value, unless the path contains a wildcard
+func fieldValues(ctx *node, field string) []interface{} {
+	nodes := resolve(ctx, field)
+	if len(nodes) == 0 && !hasWildcard(field) {
+		return []interface{}{nil}
+	}
+	ret := make([]interface{}, len(nodes))
+	for i, n := range nodes {
+		ret[i] = n.value
+	}
+	return ret
+}
+
+func isNary(op string) bool {
+	switch op {
+	case "$in", "$nin", "$not_in":
+		return true
+	}
+	return false
+}
+
+// compareValues returns true if any of the field values satisfies
+// the operator for the given rvalues
+func compareValues(lvalues []interface{}, op string, rvalues []interface{}) (bool, error) {
+	for _, l := range lvalues {
+		r, err := compareValue(l, op, rvalues)
+		if err != nil || r {
+			return r, err
+		}
+	}
+	return false, nil
+}
+
+func compareValue(l interface{}, op string, rvalues []interface{}) (bool, error) {
+	switch op {
+	case "$in":
+		return contains(rvalues, l), nil
+	case "$nin", "$not_in":
+		return !contains(rvalues, l), nil
+	}
+	if len(rvalues) == 0 {
+		return false, nil
+	}
+	r := rvalues[0]
+	switch op {
+	case "=", "$eq":
+		return equal(l, r), nil
+	case "!=", "$neq":
+		return !equal(l, r), nil
+	}
+	c, ok := compare(l, r)
+	if !ok {
+		switch op {
+		case "<", "$lt", "<=", "$lte", ">", "$gt", ">=", "$gte":
+			return false, nil
+		}
+		return false, fmt.Errorf("Invalid operator: %s", op)
+	}
+	switch op {
+	case "<", "$lt":
+		return c < 0, nil
+	case "<=", "$lte":
+		return c <= 0, nil
+	case ">", "$gt":
+		return c > 0, nil
+	case ">=", "$gte":
+		return c >= 0, nil
+	}
+	return false, fmt.Errorf("Invalid operator: %s", op)
+}
+
+func contains(values []interface{}, v interface{}) bool {
+	for _, x := range values {
+		if equal(x, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// regex evaluates a regular expression query
+func regex(field string, p interface{}, q map[string]interface{}, ctx *node) (bool, error) {
+	pattern, ok := p.(string)
+	if !ok {
+		return false, fmt.Errorf("Invalid regex: %v", p)
+	}
+	flags := ""
+	if q["caseInsensitive"] == true {
+		flags += "i"
+	}
+	if q["multiline"] == true {
+		flags += "m"
+	}
+	if q["dotall"] == true {
+		flags += "s"
+	}
+	if q["extended"] == true {
+		pattern = stripWhitespace(pattern)
+	}
+	if len(flags) > 0 {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range fieldValues(ctx, field) {
+		if s, ok := v.(string); ok && re.MatchString(s) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// stripWhitespace removes unescaped whitespace from an extended regex pattern
+func stripWhitespace(pattern string) string {
+	var b strings.Builder
+	escaped := false
+	for _, c := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// arrays returns the array nodes at field
+func arrays(field string, ctx *node) []*node {
+	var ret []*node
+	for _, n := range resolve(ctx, field) {
+		if _, ok := n.value.([]interface{}); ok {
+			ret = append(ret, n)
+		}
+	}
+	return ret
+}
+
+// arrayContains evaluates {array:field, contains:op, values:[...]}
+func arrayContains(field string, q map[string]interface{}, ctx *node) (bool, error) {
+	values, ok := q["values"].([]interface{})
+	if !ok {
+		return false, fmt.Errorf("Invalid values: %v", q["values"])
+	}
+	op, _ := q["contains"].(string)
+	for _, n := range arrays(field, ctx) {
+		elements := n.value.([]interface{})
+		var r bool
+		switch op {
+		case "$any":
+			r = false
+			for _, v := range values {
+				if contains(elements, v) {
+					r = true
+					break
+				}
+			}
+		case "$all":
+			r = true
+			for _, v := range values {
+				if !contains(elements, v) {
+					r = false
+					break
+				}
+			}
+		case "$none":
+			r = true
+			for _, v := range values {
+				if contains(elements, v) {
+					r = false
+					break
+				}
+			}
+		default:
+			return false, fmt.Errorf("Invalid array operator: %s", op)
+		}
+		if r {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// elemMatch evaluates {array:field, elemMatch:q}. The query is
+// evaluated for each element, with field names relative to the element
+func elemMatch(field string, q interface{}, ctx *node) (bool, error) {
+	for _, n := range arrays(field, ctx) {
+		for _, e := range n.value.([]interface{}) {
+			r, err := matches(q, &node{value: e, parent: n})
+			if err != nil || r {
+				return r, err
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,339 @@
+package eval
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// Apply applies an update expression to a document. The update is
+// the JSON representation of a lightblue update expression, either a
+// single operation, or an array of operations
+func Apply(update interface{}, doc map[string]interface{}) error {
+	var root interface{} = doc
+	_, err := apply(update, root)
+	return err
+}
+
+// apply applies the update to target, and returns the updated
+// target. Field names are relative to target
+func apply(update interface{}, target interface{}) (interface{}, error) {
+	switch u := update.(type) {
+	case nil:
+		return target, nil
+	case []interface{}:
+		var err error
+		for _, x := range u {
+			if target, err = apply(x, target); err != nil {
+				return nil, err
+			}
+		}
+		return target, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(u))
+		for k := range u {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var err error
+		for _, k := range keys {
+			if target, err = applyOp(k, u[k], target); err != nil {
+				return nil, err
+			}
+		}
+		return target, nil
+	}
+	return nil, fmt.Errorf("Invalid update: %v", update)
+}
+
+func applyOp(op string, arg interface{}, target interface{}) (interface{}, error) {
+	switch op {
+	case "$set", "$add":
+		m, ok := arg.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Invalid %s: %v", op, arg)
+		}
+		for _, field := range sortedKeys(m) {
+			value, err := rvalue(m[field], target)
+			if err != nil {
+				return nil, err
+			}
+			if op == "$set" {
+				target, err = modify(target, splitPath(field), func(interface{}, bool) (interface{}, bool, error) {
+					return value, false, nil
+				})
+			} else {
+				target, err = modify(target, splitPath(field), func(old interface{}, exists bool) (interface{}, bool, error) {
+					if !exists || old == nil {
+						old = 0.0
+					}
+					sum, ok := add(old, value)
+					if !ok {
+						return nil, false, fmt.Errorf("Cannot add %v to %s", value, field)
+					}
+					return sum, false, nil
+				})
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		return target, nil
+	case "$unset":
+		var fields []interface{}
+		switch f := arg.(type) {
+		case string:
+			fields = []interface{}{f}
+		case []interface{}:
+			fields = f
+		default:
+			return nil, fmt.Errorf("Invalid $unset: %v", arg)
+		}
+		for _, f := range fields {
+			field, ok := f.(string)
+			if !ok {
+				return nil, fmt.Errorf("Invalid $unset: %v", arg)
+			}
+			var err error
+			target, err = modify(target, splitPath(field), func(interface{}, bool) (interface{}, bool, error) {
+				return nil, true, nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		return target, nil
+	case "$append", "$insert":
+		m, ok := arg.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("Invalid %s: %v", op, arg)
+		}
+		for _, field := range sortedKeys(m) {
+			values, err := rvalues(m[field], target)
+			if err != nil {
+				return nil, err
+			}
+			path := splitPath(field)
+			// $append adds to the end of the array, $insert adds at the
+			// index given as the last segment of the field
+			at := ""
+			if op == "$insert" {
+				if len(path) < 2 {
+					return nil, fmt.Errorf("Invalid $insert field: %s", field)
+				}
+				path, at = path[:len(path)-1], path[len(path)-1]
+			}
+			target, err = modify(target, path, func(old interface{}, exists bool) (interface{}, bool, error) {
+				var arr []interface{}
+				if exists && old != nil {
+					var ok bool
+					if arr, ok = old.([]interface{}); !ok {
+						return nil, false, fmt.Errorf("Not an array: %s", field)
+					}
+				}
+				n := len(arr)
+				if len(at) > 0 {
+					i, ok := index(at, len(arr))
+					if !ok || i > len(arr) {
+						return nil, false, fmt.Errorf("Invalid array index: %s", field)
+					}
+					n = i
+				}
+				ret := make([]interface{}, 0, len(arr)+len(values))
+				ret = append(ret, arr[:n]...)
+				ret = append(ret, values...)
+				ret = append(ret, arr[n:]...)
+				return ret, false, nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		return target, nil
+	case "$foreach":
+		return foreach(arg, target)
+	}
+	return nil, fmt.Errorf("Unknown update operation: %s", op)
+}
+
+// foreach applies {$foreach: {<array>: query|$all, $update: update|$remove}}
+func foreach(arg interface{}, target interface{}) (interface{}, error) {
+	m, ok := arg.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Invalid $foreach: %v", arg)
+	}
+	update, ok := m["$update"]
+	if !ok {
+		return nil, fmt.Errorf("Missing $update in $foreach: %v", arg)
+	}
+	var field string
+	var query interface{}
+	for k, v := range m {
+		if k != "$update" {
+			if len(field) > 0 {
+				return nil, fmt.Errorf("Invalid $foreach: %v", arg)
+			}
+			field, query = k, v
+		}
+	}
+	if len(field) == 0 {
+		return nil, fmt.Errorf("Missing array in $foreach: %v", arg)
+	}
+	if query == "$all" {
+		query = nil
+	}
+	return modify(target, splitPath(field), func(old interface{}, exists bool) (interface{}, bool, error) {
+		if !exists || old == nil {
+			return old, !exists, nil
+		}
+		arr, ok := old.([]interface{})
+		if !ok {
+			return nil, false, fmt.Errorf("Not an array: %s", field)
+		}
+		ret := make([]interface{}, 0, len(arr))
+		for _, e := range arr {
+			match, err := Matches(query, e)
+			if err != nil {
+				return nil, false, err
+			}
+			if !match {
+				ret = append(ret, e)
+				continue
+			}
+			if update == "$remove" {
+				continue
+			}
+			e, err = apply(update, e)
+			if err != nil {
+				return nil, false, err
+			}
+			ret = append(ret, e)
+		}
+		return ret, false, nil
+	})
+}
+
+// modify calls f with the value at path under target, and replaces
+// it with the value f returns, or removes it if f returns true for
+// remove. Missing intermediate objects are created. Returns the
+// modified target
+func modify(target interface{}, path []string, f func(old interface{}, exists bool) (interface{}, bool, error)) (interface{}, error) {
+	if len(path) == 0 || (len(path) == 1 && path[0] == "$this") {
+		v, remove, err := f(target, true)
+		if remove {
+			return nil, err
+		}
+		return v, err
+	}
+	seg, rest := path[0], path[1:]
+	switch t := target.(type) {
+	case map[string]interface{}:
+		old, exists := t[seg]
+		if len(rest) == 0 {
+			v, remove, err := f(old, exists)
+			if err != nil {
+				return nil, err
+			}
+			if remove {
+				delete(t, seg)
+			} else {
+				t[seg] = v
+			}
+			return t, nil
+		}
+		if !exists || old == nil {
+			old = make(map[string]interface{})
+		}
+		v, err := modify(old, rest, f)
+		if err != nil {
+			return nil, err
+		}
+		t[seg] = v
+		return t, nil
+	case []interface{}:
+		i, ok := index(seg, len(t))
+		if !ok || i >= len(t) {
+			return nil, fmt.Errorf("Invalid array index: %s", seg)
+		}
+		if len(rest) == 0 {
+			v, remove, err := f(t[i], true)
+			if err != nil {
+				return nil, err
+			}
+			if remove {
+				return append(t[:i:i], t[i+1:]...), nil
+			}
+			t[i] = v
+			return t, nil
+		}
+		v, err := modify(t[i], rest, f)
+		if err != nil {
+			return nil, err
+		}
+		t[i] = v
+		return t, nil
+	case nil:
+		return modify(make(map[string]interface{}), path, f)
+	}
+	return nil, fmt.Errorf("Cannot set %s in %v", seg, target)
+}
+
+// rvalue resolves a {$valueof: field} relative to target, or returns the literal value
+func rvalue(v interface{}, target interface{}) (interface{}, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) != 1 {
+		return v, nil
+	}
+	f, ok := m["$valueof"]
+	if !ok {
+		return v, nil
+	}
+	field, ok := f.(string)
+	if !ok {
+		return nil, fmt.Errorf("Invalid $valueof: %v", v)
+	}
+	nodes := resolve(&node{value: target}, field)
+	switch len(nodes) {
+	case 0:
+		return nil, nil
+	case 1:
+		return deepCopy(nodes[0].value), nil
+	}
+	return nil, fmt.Errorf("Multiple values for $valueof: %s", field)
+}
+
+// rvalues resolves a list of rvalues. A single value is treated as a list of one
+func rvalues(v interface{}, target interface{}) ([]interface{}, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		list = []interface{}{v}
+	}
+	ret := make([]interface{}, len(list))
+	for i, x := range list {
+		var err error
+		if ret[i], err = rvalue(x, target); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// add returns a+b
+func add(a, b interface{}) (interface{}, bool) {
+	x, ok1 := number(a)
+	y, ok2 := number(b)
+	if !ok1 || !ok2 {
+		return nil, false
+	}
+	f, _ := new(big.Float).Add(x, y).Float64()
+	return f, true
+}
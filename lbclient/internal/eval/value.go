@@ -0,0 +1,168 @@
+package eval
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"time"
+)
+
+// dateFormats are the date formats recognized when comparing
+// strings: the lightblue date format, and the format encoding/json
+// uses for time.Time
+var dateFormats = []string{"20060102T15:04:05.000-0700", time.RFC3339Nano}
+
+// date parses s as a date in one of dateFormats
+func date(s string) (time.Time, bool) {
+	for _, f := range dateFormats {
+		if t, err := time.Parse(f, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// number converts a numeric value to a big.Float
+func number(v interface{}) (*big.Float, bool) {
+	switch n := v.(type) {
+	case float64:
+		return new(big.Float).SetFloat64(n), true
+	case float32:
+		return new(big.Float).SetFloat64(float64(n)), true
+	case int:
+		return new(big.Float).SetInt64(int64(n)), true
+	case int8:
+		return new(big.Float).SetInt64(int64(n)), true
+	case int16:
+		return new(big.Float).SetInt64(int64(n)), true
+	case int32:
+		return new(big.Float).SetInt64(int64(n)), true
+	case int64:
+		return new(big.Float).SetInt64(n), true
+	case uint:
+		return new(big.Float).SetUint64(uint64(n)), true
+	case uint8:
+		return new(big.Float).SetUint64(uint64(n)), true
+	case uint16:
+		return new(big.Float).SetUint64(uint64(n)), true
+	case uint32:
+		return new(big.Float).SetUint64(uint64(n)), true
+	case uint64:
+		return new(big.Float).SetUint64(n), true
+	case json.Number:
+		f, _, err := big.ParseFloat(string(n), 10, 256, big.ToNearestEven)
+		return f, err == nil
+	}
+	return nil, false
+}
+
+// compare compares two values. Returns false if the values are not
+// comparable. Numbers are compared numerically, dates
+// chronologically, other strings lexicographically, and booleans with
+// false<true. Null is only comparable to null. Objects and arrays are
+// only compared for equality, and return 0 if they are equal
+func compare(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		if a == nil && b == nil {
+			return 0, true
+		}
+		return 0, false
+	}
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			return x.Cmp(y), true
+		}
+		return 0, false
+	}
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			if x != y {
+				if tx, ok := date(x); ok {
+					if ty, ok := date(y); ok {
+						return tx.Compare(ty), true
+					}
+				}
+			}
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, true
+			case y:
+				return -1, true
+			}
+			return 1, true
+		}
+	case map[string]interface{}, []interface{}:
+		if equal(a, b) {
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+// equal returns true if the two values are equal, comparing numbers numerically
+func equal(a, b interface{}) bool {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// deepCopy returns a copy of a JSON value
+func deepCopy(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(t))
+		for k, x := range t {
+			ret[k] = deepCopy(x)
+		}
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(t))
+		for i, x := range t {
+			ret[i] = deepCopy(x)
+		}
+		return ret
+	}
+	return v
+}
+
+// DeepCopy returns a copy of a document
+func DeepCopy(doc map[string]interface{}) map[string]interface{} {
+	return deepCopy(doc).(map[string]interface{})
+}
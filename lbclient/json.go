@@ -0,0 +1,131 @@
+package lbclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// jsonObject decodes a JSON object into its raw fields. Only the
+// given fields are allowed
+func jsonObject(data []byte, allowed ...string) (map[string]json.RawMessage, error) {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("Expected object: %s", err)
+	}
+	if m == nil {
+		return nil, fmt.Errorf("Expected object, got null")
+	}
+	if len(allowed) > 0 {
+		var unexpected []string
+		for k := range m {
+			found := false
+			for _, a := range allowed {
+				if k == a {
+					found = true
+					break
+				}
+			}
+			if !found {
+				unexpected = append(unexpected, k)
+			}
+		}
+		if len(unexpected) > 0 {
+			sort.Strings(unexpected)
+			return nil, fmt.Errorf("Unexpected fields: %s", strings.Join(unexpected, ","))
+		}
+	}
+	return m, nil
+}
+
+// jsonArray decodes a JSON array into its raw elements. If the
+// value is not an array, it is returned as the only element
+func jsonArray(data []byte) ([]json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var arr []json.RawMessage
+		if err := json.Unmarshal(trimmed, &arr); err != nil {
+			return nil, err
+		}
+		return arr, nil
+	}
+	return []json.RawMessage{trimmed}, nil
+}
+
+// jsonString decodes a required string field
+func jsonString(m map[string]json.RawMessage, name string) (string, error) {
+	raw, ok := m[name]
+	if !ok {
+		return "", fmt.Errorf("Missing %s", name)
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", fmt.Errorf("%s: expected string", name)
+	}
+	return s, nil
+}
+
+// jsonBool decodes an optional boolean field
+func jsonBool(m map[string]json.RawMessage, name string, def bool) (bool, error) {
+	raw, ok := m[name]
+	if !ok {
+		return def, nil
+	}
+	var b bool
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return false, fmt.Errorf("%s: expected boolean", name)
+	}
+	return b, nil
+}
+
+// jsonTree returns the JSON representation of v as a tree of
+// map[string]interface{}, []interface{} and scalar values. Numbers
+// are decoded as json.Number to keep their precision
+func jsonTree(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var tree interface{}
+	if err := d.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// treeCopy returns a copy of v as a JSON tree. Maps, slices and
+// scalars that are already part of a JSON tree are copied as they
+// are, other values are replaced by their JSON representation using
+// jsonTree
+func treeCopy(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case nil, bool, string, json.Number, float64, float32,
+		int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return v, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(x))
+		for k, e := range x {
+			c, err := treeCopy(e)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", k, err)
+			}
+			m[k] = c
+		}
+		return m, nil
+	case []interface{}:
+		arr := make([]interface{}, len(x))
+		for i, e := range x {
+			c, err := treeCopy(e)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %s", i, err)
+			}
+			arr[i] = c
+		}
+		return arr, nil
+	}
+	return jsonTree(withDates(v))
+}
@@ -0,0 +1,222 @@
+package lbclient
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTrip marshals v, unmarshals it into into, and marshals it
+// again, returning both encodings
+func roundTrip(t *testing.T, v interface{}, into interface{}) (string, string) {
+	first, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal %v: %s", v, err)
+	}
+	if err := json.Unmarshal(first, into); err != nil {
+		t.Fatalf("Unmarshal %s: %s", string(first), err)
+	}
+	second, err := json.Marshal(into)
+	if err != nil {
+		t.Fatalf("Marshal %v: %s", into, err)
+	}
+	return string(first), string(second)
+}
+
+func TestQueryRoundTrip(t *testing.T) {
+	queries := []*Query{
+		CmpValue("f", EQ, LitStr("s")),
+		CmpValue("f", GTE, LitInt(12)),
+		CmpValue("f", LT, LitDouble(1.5)),
+		CmpValue("f", NEQ, LitBool(true)),
+		CmpValue("f", EQ, LitNull()),
+		CmpValue("f", EQ, LitDate(time.Date(2017, time.January, 15, 13, 11, 15, 123000000, time.UTC))),
+		CmpValues("f", IN, LitInts(1, 2, 3)...),
+		CmpValues("f", NIN, LitStrs("a", "b")...),
+		CmpField("f", GT, "g"),
+		CmpFieldValues("f", IN, "arr"),
+		CmpRegex("f", "^a.*", RegexOptions{CaseInsensitive: true, Multiline: true}),
+		Not(CmpValue("f", EQ, LitInt(1))),
+		And(CmpValue("a", EQ, LitInt(1)), Or(CmpValue("b", EQ, LitInt(2)), CmpField("c", NEQ, "d"))),
+		ArrayContains("arr", ANY, LitStrs("x", "y")...),
+		ArrayMatch("arr", And(CmpValue("x", EQ, LitInt(1)), CmpValue("y", LTE, LitInt(2)))),
+	}
+	for _, q := range queries {
+		var out Query
+		first, second := roundTrip(t, q, &out)
+		if first != second {
+			t.Errorf("Expected %s, got %s", first, second)
+		}
+	}
+}
+
+func TestQueryUnmarshalAliases(t *testing.T) {
+	var q Query
+	if err := json.Unmarshal([]byte(`{"field":"f","op":"$eq","rvalue":1}`), &q); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(q)
+	if string(b) != `{"field":"f","op":"=","rvalue":1}` {
+		t.Errorf("Wrong query: %s", string(b))
+	}
+}
+
+func TestQueryUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		in, err string
+	}{
+		{`[]`, "Expected object"},
+		{`{"field":"f","op":"~","rvalue":1}`, "~"},
+		{`{"field":"f","op":"=","rvalue":1,"x":2}`, "x"},
+		{`{"$and":[{"field":"f","op":"=","rvalue":1},{"field":"f"}]}`, "$and[1]"},
+		{`{"$and":{}}`, "$and"},
+		{`{"array":"a","contains":"$some","values":[1]}`, "$some"},
+	}
+	for _, x := range tests {
+		var q Query
+		err := json.Unmarshal([]byte(x.in), &q)
+		if err == nil {
+			t.Errorf("Expected error for %s", x.in)
+		} else if !strings.Contains(err.Error(), x.err) {
+			t.Errorf("Expected error containing %s for %s, got %s", x.err, x.in, err)
+		}
+	}
+}
+
+func TestProjectionRoundTrip(t *testing.T) {
+	s := Sort{Keys: []SortKey{{Field: "x", Descending: true}}}
+	projections := []*Projection{
+		MakeProjection(IncludeField("a", false)),
+		MakeProjection(IncludeTree("*"), ExcludeField("b", true)),
+		MakeProjection(IncludeRange("arr", [2]int{0, 5}, MakeProjection(IncludeField("x", false)), &s)),
+		MakeProjection(ExcludeMatching("arr", *CmpValue("x", EQ, LitInt(1)), MakeProjection(IncludeTree("*")), nil)),
+	}
+	for _, p := range projections {
+		var out Projection
+		first, second := roundTrip(t, p, &out)
+		if first != second {
+			t.Errorf("Expected %s, got %s", first, second)
+		}
+	}
+	var out Projection
+	if err := json.Unmarshal([]byte(`{"field":"arr","range":[0,1]}`), &out); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out.p[0].(RangeProjection); !ok {
+		t.Errorf("Expected range projection, got %T", out.p[0])
+	}
+}
+
+func TestProjectionUnmarshalErrors(t *testing.T) {
+	for _, in := range []string{
+		`{"include":true}`,
+		`{"field":"a","include":"yes"}`,
+		`{"field":"a","range":[0,1],"match":{"field":"x","op":"=","rvalue":1}}`,
+		`{"field":"a","range":[0]}`,
+		`{"field":"a","range":[1,null]}`,
+		`{"field":"a","range":[null,1]}`,
+		`{"field":"a","range":[0,1.5]}`,
+		`{"field":"a","range":["0",1]}`,
+		`{"field":"a","unknown":1}`,
+	} {
+		var p Projection
+		if err := json.Unmarshal([]byte(in), &p); err == nil {
+			t.Errorf("Expected error for %s", in)
+		}
+	}
+}
+
+func TestProjectionUnmarshalRangeError(t *testing.T) {
+	var p Projection
+	err := json.Unmarshal([]byte(`{"field":"a","range":[1,null]}`), &p)
+	if err == nil || err.Error() != "projection[0]: Invalid range: [1,null]: bound 1 is null" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSortRoundTrip(t *testing.T) {
+	s := Sort{Keys: []SortKey{{Field: "a"}, {Field: "b", Descending: true}}}
+	var out Sort
+	first, second := roundTrip(t, s, &out)
+	if first != second {
+		t.Errorf("Expected %s, got %s", first, second)
+	}
+	if err := json.Unmarshal([]byte(`{"a":"$up"}`), &out); err == nil {
+		t.Errorf("Expected error for invalid direction")
+	}
+	if err := json.Unmarshal([]byte(`{"a":"$asc","b":"$desc"}`), &out); err == nil {
+		t.Errorf("Expected error for multi-field sort key")
+	}
+}
+
+func TestRangeRoundTrip(t *testing.T) {
+	for _, r := range []Range{{0, 10}, EMPTYRANGE, ALLRANGE} {
+		var out Range
+		first, second := roundTrip(t, r, &out)
+		if first != second || out != r {
+			t.Errorf("Expected %s, got %s", first, second)
+		}
+	}
+	for _, in := range []string{`[1]`, `[null,2]`, `"x"`} {
+		var r Range
+		if err := json.Unmarshal([]byte(in), &r); err == nil {
+			t.Errorf("Expected error for %s", in)
+		}
+	}
+}
+
+func TestUpdateRoundTrip(t *testing.T) {
+	var inner Update
+	inner.Set("x", LitInt(1))
+	updates := []*Update{
+		new(Update).Set("a", LitStr("s")),
+		new(Update).Set("a", ValueOfField("b")).Unset("c").Add("d", LitInt(2)),
+		new(Update).Append("arr", LitInt(1), LitInt(2)).Insert("arr.0", LitStr("x")),
+		new(Update).ForEach("arr", CmpValue("x", EQ, LitInt(1)), &inner),
+		new(Update).ForEach("arr", nil, nil),
+		new(Update).Remove("arr", nil),
+	}
+	for _, u := range updates {
+		var out Update
+		first, second := roundTrip(t, u, &out)
+		if first != second {
+			t.Errorf("Expected %s, got %s", first, second)
+		}
+	}
+}
+
+func TestUpdateUnmarshal(t *testing.T) {
+	var u Update
+	if err := json.Unmarshal([]byte(`{"$set":{"b":1,"a":{"$valueof":"c"}}}`), &u); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(u)
+	if string(b) != `[{"$set":{"a":{"$valueof":"c"}}},{"$set":{"b":1}}]` {
+		t.Errorf("Wrong update: %s", string(b))
+	}
+	if err := json.Unmarshal([]byte(`{"$unset":["a","b"]}`), &u); err != nil {
+		t.Fatal(err)
+	}
+	if len(u.u) != 2 {
+		t.Errorf("Expected two unsets, got %v", u.u)
+	}
+	if err := json.Unmarshal([]byte(`{"$foreach":{"arr":"$all","$update":"$remove"}}`), &u); err != nil {
+		t.Fatal(err)
+	}
+	f, ok := u.u[0].(ForEachOperation)
+	if !ok || f.field != "arr" || !f.q.isAll || !f.u.isRemove {
+		t.Errorf("Wrong foreach: %v", u.u[0])
+	}
+	for _, in := range []string{
+		`{"$rename":{"a":"b"}}`,
+		`{"$set":{"a":1},"$unset":"b"}`,
+		`{"$unset":1}`,
+		`{"$foreach":{"arr":"$all"}}`,
+		`[{"$set":{"a":1}},{"$set":[]}]`,
+	} {
+		if err := json.Unmarshal([]byte(in), &u); err == nil {
+			t.Errorf("Expected error for %s", in)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Package lbclienttest provides in-memory implementations of the
+// lbclient data service and locking clients for unit tests.
+package lbclienttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/lightblue-platform/go-client/lbclient"
+	"github.com/lightblue-platform/go-client/lbclient/internal/eval"
+)
+
+// Client is an in-memory lbclient.ContextDataServiceClient. It
+// stores documents per entity and version, and evaluates queries,
+// projections, sorts, ranges and updates the way the lightblue
+// server does. It can be shared by multiple goroutines.
+type Client struct {
+	// HostName is returned in responses
+	HostName string
+
+	mu              sync.Mutex
+	collections     map[collectionKey][]*record
+	defaultVersions map[string]string
+	failures        map[lbclient.CrudOperation][][]lbclient.RequestError
+	nextId          int
+}
+
+type collectionKey struct {
+	entity, version string
+}
+
+// record is a stored document, and its version
+type record struct {
+	doc     map[string]interface{}
+	version int
+}
+
+func (r *record) id() interface{} {
+	return r.doc["_id"]
+}
+
+func (r *record) documentVersion() string {
+	return fmt.Sprintf("%v:%d", r.id(), r.version)
+}
+
+var _ lbclient.ContextDataServiceClient = &Client{}
+
+// NewClient returns an empty in-memory client
+func NewClient() *Client {
+	return &Client{HostName: "lbclienttest",
+		collections:     make(map[collectionKey][]*record),
+		defaultVersions: make(map[string]string),
+		failures:        make(map[lbclient.CrudOperation][][]lbclient.RequestError)}
+}
+
+// SetDefaultVersion sets the version used for requests that do not
+// specify an entity version
+func (c *Client) SetDefaultVersion(entityName, version string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.defaultVersions[entityName] = version
+}
+
+// Load stores documents in the given entity version without any
+// checks. docs can be anything accepted by lbclient.MakeDocData.
+// Documents without an _id are assigned one.
+func (c *Client) Load(entityName, version string, docs interface{}) error {
+	parsed, err := parseDocs(lbclient.MakeDocData(docs))
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := c.key(entityName, version)
+	for _, d := range parsed {
+		c.assignId(d)
+		c.collections[key] = append(c.collections[key], &record{doc: d, version: 1})
+	}
+	return nil
+}
+
+// Documents returns copies of the documents stored in the given entity version
+func (c *Client) Documents(entityName, version string) []map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	records := c.collections[c.key(entityName, version)]
+	ret := make([]map[string]interface{}, len(records))
+	for i, r := range records {
+		ret[i] = eval.DeepCopy(r.doc)
+	}
+	return ret
+}
+
+// FailNext makes the next call of the given operation fail with the
+// given errors, without changing any data. Multiple calls queue
+// multiple failures.
+func (c *Client) FailNext(op lbclient.CrudOperation, errors ...lbclient.RequestError) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures[op] = append(c.failures[op], errors)
+}
+
+func (c *Client) key(entityName, version string) collectionKey {
+	if len(version) == 0 {
+		version = c.defaultVersions[entityName]
+	}
+	return collectionKey{entity: entityName, version: version}
+}
+
+func (c *Client) assignId(doc map[string]interface{}) {
+	if _, ok := doc["_id"]; !ok {
+		c.nextId++
+		doc["_id"] = fmt.Sprintf("%024x", c.nextId)
+	}
+}
+
+// nextFailure returns the queued failure for op, if any
+func (c *Client) nextFailure(op lbclient.CrudOperation) []lbclient.RequestError {
+	q := c.failures[op]
+	if len(q) == 0 {
+		return nil
+	}
+	c.failures[op] = q[1:]
+	return q[0]
+}
+
+// find returns the index of the record with id, or -1. Ids are
+// compared by value, as they may be objects or arrays
+func (c *Client) find(records []*record, id interface{}) int {
+	for i, r := range records {
+		if reflect.DeepEqual(r.id(), id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// response is the wire representation of a response, decoded using lbclient.DecodeResponse
+type response struct {
+	EntityName     string                   `json:"entity"`
+	EntityVersion  string                   `json:"entityVersion"`
+	HostName       string                   `json:"hostname"`
+	Status         lbclient.OpStatus        `json:"status"`
+	ModifiedCount  int                      `json:"modifiedCount"`
+	MatchCount     int                      `json:"matchCount"`
+	ResultMetadata []lbclient.ResultMd      `json:"resultMetadata,omitempty"`
+	EntityData     []map[string]interface{} `json:"processed,omitempty"`
+	DataErrors     []lbclient.DataError     `json:"dataErrors,omitempty"`
+	Errors         []lbclient.RequestError  `json:"errors,omitempty"`
+}
+
+func (c *Client) newResponse(h *lbclient.RequestHeader) *response {
+	return &response{EntityName: h.EntityName, EntityVersion: c.key(h.EntityName, h.EntityVersion).version, HostName: c.HostName}
+}
+
+// errorResponse returns a response with the given errors
+func (c *Client) errorResponse(h *lbclient.RequestHeader, errors ...lbclient.RequestError) *response {
+	r := c.newResponse(h)
+	r.Status = lbclient.ERROR
+	r.Errors = errors
+	return r
+}
+
+// status returns the status for an operation that modified some
+// documents, and failed for others
+func status(modified, failed int) lbclient.OpStatus {
+	switch {
+	case failed == 0:
+		return lbclient.COMPLETE
+	case modified > 0:
+		return lbclient.PARTIAL
+	}
+	return lbclient.ERROR
+}
+
+func crudError(code, ctx, msg string) lbclient.RequestError {
+	return lbclient.RequestError{Context: ctx, ErrorCode: code, Msg: msg}
+}
+
+// decode returns the response as the HTTP client would return it
+func decode(r *response, data interface{}) (*lbclient.Response, error) {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return lbclient.DecodeResponse(body, lbclient.ReturnDataType(data))
+}
+
+// toTree converts an expression to its JSON tree representation
+func toTree(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var ret interface{}
+	err = json.Unmarshal(b, &ret)
+	return ret, err
+}
+
+func parseDocs(data json.RawMessage) ([]map[string]interface{}, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var docs []map[string]interface{}
+	if err := json.Unmarshal(data, &docs); err != nil {
+		var doc map[string]interface{}
+		if json.Unmarshal(data, &doc) != nil {
+			return nil, err
+		}
+		docs = []map[string]interface{}{doc}
+	}
+	return docs, nil
+}
+
+// expressions converts the non-nil expressions to JSON trees
+func expressions(exprs ...interface{}) ([]interface{}, error) {
+	ret := make([]interface{}, len(exprs))
+	for i, x := range exprs {
+		if x == nil {
+			continue
+		}
+		t, err := toTree(x)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = t
+	}
+	return ret, nil
+}
+
+// rangeBounds returns the from and to (inclusive) indexes for n results
+func rangeBounds(r *lbclient.Range, n int) (int, int) {
+	if r == nil {
+		return 0, n - 1
+	}
+	var bounds []*int
+	b, _ := json.Marshal(r)
+	json.Unmarshal(b, &bounds)
+	from, to := 0, n-1
+	if len(bounds) == 2 {
+		if bounds[0] != nil {
+			from = *bounds[0]
+		}
+		if bounds[1] != nil && *bounds[1] < to {
+			to = *bounds[1]
+		}
+	}
+	return from, to
+}
@@ -0,0 +1,158 @@
+package lbclienttest
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/lightblue-platform/go-client/lbclient"
+)
+
+type user struct {
+	Id   string   `json:"_id,omitempty"`
+	Name string   `json:"name"`
+	Age  int      `json:"age"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+func header() lbclient.RequestHeader {
+	return lbclient.RequestHeader{EntityName: "user", EntityVersion: "1.0.0"}
+}
+
+func loadUsers(t *testing.T) *Client {
+	c := NewClient()
+	err := c.Load("user", "1.0.0", []user{{Id: "1", Name: "ann", Age: 30, Tags: []string{"a"}},
+		{Id: "2", Name: "bob", Age: 20},
+		{Id: "3", Name: "cat", Age: 40, Tags: []string{"a", "b"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestFind(t *testing.T) {
+	c := loadUsers(t)
+	resp, err := c.Find(&lbclient.FindRequest{RequestHeader: header(),
+		Q: lbclient.ArrayContains("tags", lbclient.ANY, lbclient.LitStr("a")),
+		P: lbclient.MakeProjection(lbclient.IncludeField("name", false)),
+		S: &lbclient.Sort{Keys: []lbclient.SortKey{{Field: "age", Descending: true}}},
+		R: lbclient.NewRange(0, 0)}, reflect.TypeOf([]user{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := resp.EntityData.([]user)
+	if resp.Status != lbclient.COMPLETE || resp.MatchCount != 2 || len(users) != 1 ||
+		users[0].Name != "cat" || users[0].Age != 0 || len(resp.ResultMetadata) != 1 {
+		t.Errorf("Unexpected response: %s", resp)
+	}
+}
+
+func TestFindTyped(t *testing.T) {
+	c := loadUsers(t)
+	resp, err := lbclient.Find[user](context.Background(), c, &lbclient.FindRequest{RequestHeader: header(),
+		Q: lbclient.Or(lbclient.CmpValue("age", lbclient.LT, lbclient.LitInt(25)),
+			lbclient.CmpRegex("name", "^A", lbclient.RegexOptions{CaseInsensitive: true}))})
+	if err != nil || len(resp.Data) != 2 || resp.Data[0].Name != "ann" || resp.Data[1].Name != "bob" {
+		t.Errorf("Unexpected response: %+v %v", resp, err)
+	}
+}
+
+func TestInsertDuplicate(t *testing.T) {
+	c := loadUsers(t)
+	resp, err := c.Insert(&lbclient.InsertRequest{RequestHeader: header(),
+		DocData: lbclient.MakeDocData([]user{{Id: "1", Name: "dup"}, {Name: "new"}})}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != lbclient.PARTIAL || resp.ModifiedCount != 1 || !lbclient.IsDuplicate(resp) {
+		t.Errorf("Unexpected response: %s", resp)
+	}
+	if len(c.Documents("user", "1.0.0")) != 4 {
+		t.Errorf("Expected 4 documents")
+	}
+}
+
+func TestInsertDuplicateObjectId(t *testing.T) {
+	c := NewClient()
+	doc := []map[string]interface{}{{"_id": map[string]interface{}{"a": "1", "b": []interface{}{"x"}}, "name": "ann"}}
+	if err := c.Load("user", "1.0.0", doc); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := c.Insert(&lbclient.InsertRequest{RequestHeader: header(),
+		DocData: lbclient.MakeDocData(doc)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ModifiedCount != 0 || !lbclient.IsDuplicate(resp) {
+		t.Errorf("Unexpected response: %s", resp)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	c := loadUsers(t)
+	var u lbclient.Update
+	u.Add("age", lbclient.LitInt(1)).Append("tags", lbclient.LitStr("c"))
+	resp, err := c.Update(&lbclient.UpdateRequest{RequestHeader: header(),
+		Q: lbclient.CmpValue("_id", lbclient.EQ, lbclient.LitStr("2")), U: &u,
+		P: lbclient.MakeProjection(lbclient.IncludeTree("*"))}, reflect.TypeOf(user{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := resp.EntityData.(user)
+	if resp.ModifiedCount != 1 || updated.Age != 21 || len(updated.Tags) != 1 || updated.Tags[0] != "c" {
+		t.Errorf("Unexpected response: %s", resp)
+	}
+}
+
+func TestSaveConcurrentUpdate(t *testing.T) {
+	c := loadUsers(t)
+	find := &lbclient.FindRequest{RequestHeader: header(), Q: lbclient.CmpValue("_id", lbclient.EQ, lbclient.LitStr("1"))}
+	resp, _ := c.Find(find, nil)
+	version := resp.ResultMetadata[0].DocumentVersion
+
+	save := &lbclient.SaveRequest{RequestHeader: header(), DocData: lbclient.MakeDocData(user{Id: "1", Name: "ann2"}),
+		IfCurrentOnly: true, DocumentVersions: []string{version}}
+	resp, err := c.Save(save, nil)
+	if err != nil || resp.Status != lbclient.COMPLETE || resp.ModifiedCount != 1 {
+		t.Errorf("Unexpected response: %s %v", resp, err)
+	}
+	resp, err = c.Save(save, nil)
+	if err != nil || resp.Status != lbclient.ERROR || !lbclient.IsConcurrentUpdate(resp) {
+		t.Errorf("Unexpected response: %s %v", resp, err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	c := loadUsers(t)
+	resp, err := c.Delete(&lbclient.DeleteRequest{RequestHeader: header(),
+		Q: lbclient.CmpValue("age", lbclient.GTE, lbclient.LitInt(30))})
+	if err != nil || resp.ModifiedCount != 2 || len(c.Documents("user", "1.0.0")) != 1 {
+		t.Errorf("Unexpected response: %s %v", resp, err)
+	}
+	resp, _ = c.Delete(&lbclient.DeleteRequest{RequestHeader: header()})
+	if resp.Status != lbclient.ERROR || !resp.HasErrorCode(lbclient.ERR_CRUD_REQUIRED) {
+		t.Errorf("Unexpected response: %s", resp)
+	}
+}
+
+func TestFailNext(t *testing.T) {
+	c := loadUsers(t)
+	c.FailNext(lbclient.CRUD_FIND, lbclient.RequestError{ErrorCode: lbclient.ERR_CRUD_NO_ACCESS})
+	resp, _ := c.Find(&lbclient.FindRequest{RequestHeader: header()}, nil)
+	if !lbclient.IsNoAccess(resp) {
+		t.Errorf("Unexpected response: %s", resp)
+	}
+	resp, _ = c.Find(&lbclient.FindRequest{RequestHeader: header()}, nil)
+	if resp.Status != lbclient.COMPLETE || resp.MatchCount != 3 {
+		t.Errorf("Unexpected response: %s", resp)
+	}
+}
+
+func TestDefaultVersion(t *testing.T) {
+	c := loadUsers(t)
+	c.SetDefaultVersion("user", "1.0.0")
+	resp, _ := c.Find(&lbclient.FindRequest{RequestHeader: lbclient.RequestHeader{EntityName: "user"}}, nil)
+	if resp.MatchCount != 3 || resp.EntityVersion != "1.0.0" {
+		t.Errorf("Unexpected response: %s", resp)
+	}
+}
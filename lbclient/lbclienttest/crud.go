@@ -0,0 +1,345 @@
+package lbclienttest
+
+import (
+	"context"
+	"sort"
+
+	"github.com/lightblue-platform/go-client/lbclient"
+	"github.com/lightblue-platform/go-client/lbclient/internal/eval"
+)
+
+// Find returns the documents matching the request
+func (c *Client) Find(request *lbclient.FindRequest, data interface{}) (*lbclient.Response, error) {
+	return c.FindContext(context.Background(), request, data)
+}
+
+// FindContext returns the documents matching the request
+func (c *Client) FindContext(ctx context.Context, request *lbclient.FindRequest, data interface{}) (*lbclient.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := &request.RequestHeader
+	if errs := c.nextFailure(lbclient.CRUD_FIND); errs != nil {
+		return decode(c.errorResponse(h, errs...), data)
+	}
+	var q, p, s interface{}
+	if request.Q != nil {
+		q = request.Q
+	}
+	if request.P != nil {
+		p = request.P
+	}
+	if request.S != nil {
+		s = request.S
+	}
+	x, err := expressions(q, p, s)
+	if err != nil {
+		return nil, err
+	}
+	matching, err := c.match(c.collections[c.key(h.EntityName, h.EntityVersion)], x[0])
+	if err == nil {
+		err = sortRecords(x[2], matching)
+	}
+	if err != nil {
+		return decode(c.errorResponse(h, crudError(lbclient.ERR_CRUD, "find", err.Error())), data)
+	}
+	resp := c.newResponse(h)
+	resp.Status = lbclient.COMPLETE
+	resp.MatchCount = len(matching)
+	resp.EntityData = []map[string]interface{}{}
+	from, to := rangeBounds(request.R, len(matching))
+	for i := from; i <= to && i < len(matching); i++ {
+		projected, err := eval.Project(x[1], matching[i].doc)
+		if err != nil {
+			return decode(c.errorResponse(h, crudError(lbclient.ERR_CRUD, "find", err.Error())), data)
+		}
+		resp.EntityData = append(resp.EntityData, projected)
+		resp.ResultMetadata = append(resp.ResultMetadata, lbclient.ResultMd{DocumentVersion: matching[i].documentVersion()})
+	}
+	return decode(resp, data)
+}
+
+func sortRecords(s interface{}, records []*record) error {
+	cmp, err := eval.Comparator(s)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(records, func(i, j int) bool { return cmp(records[i].doc, records[j].doc) < 0 })
+	return nil
+}
+
+// match returns the records matching the query
+func (c *Client) match(records []*record, query interface{}) ([]*record, error) {
+	var ret []*record
+	for _, r := range records {
+		ok, err := eval.Matches(query, r.doc)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ret = append(ret, r)
+		}
+	}
+	return ret, nil
+}
+
+// addProcessed adds the projected documents of the records to the
+// response, if there is a projection
+func addProcessed(resp *response, projection interface{}, records []*record) error {
+	if projection == nil {
+		return nil
+	}
+	resp.EntityData = []map[string]interface{}{}
+	for _, r := range records {
+		projected, err := eval.Project(projection, r.doc)
+		if err != nil {
+			return err
+		}
+		resp.EntityData = append(resp.EntityData, projected)
+		resp.ResultMetadata = append(resp.ResultMetadata, lbclient.ResultMd{DocumentVersion: r.documentVersion()})
+	}
+	return nil
+}
+
+func dataError(doc map[string]interface{}, code, ctx, msg string) lbclient.DataError {
+	return lbclient.DataError{EntityData: []map[string]interface{}{doc},
+		Errors: []lbclient.RequestError{crudError(code, ctx, msg)}}
+}
+
+// Insert adds new documents. Documents without an _id are assigned
+// one. Inserting a document with an existing _id fails with a
+// mongo-crud:Duplicate data error
+func (c *Client) Insert(request *lbclient.InsertRequest, data interface{}) (*lbclient.Response, error) {
+	return c.InsertContext(context.Background(), request, data)
+}
+
+// InsertContext adds new documents. See Insert
+func (c *Client) InsertContext(ctx context.Context, request *lbclient.InsertRequest, data interface{}) (*lbclient.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := &request.RequestHeader
+	if errs := c.nextFailure(lbclient.CRUD_INSERT); errs != nil {
+		return decode(c.errorResponse(h, errs...), data)
+	}
+	var p interface{}
+	if request.P != nil {
+		p = request.P
+	}
+	x, err := expressions(p)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := parseDocs(request.DocData)
+	if err != nil || len(docs) == 0 {
+		return decode(c.errorResponse(h, crudError(lbclient.ERR_CRUD_REQUIRED, "insert", "data")), data)
+	}
+	key := c.key(h.EntityName, h.EntityVersion)
+	resp := c.newResponse(h)
+	var inserted []*record
+	for _, d := range docs {
+		c.assignId(d)
+		if c.find(c.collections[key], d["_id"]) >= 0 {
+			resp.DataErrors = append(resp.DataErrors, dataError(d, lbclient.ERR_MONGO_DUPLICATE, "insert", "Duplicate _id"))
+			continue
+		}
+		r := &record{doc: d, version: 1}
+		c.collections[key] = append(c.collections[key], r)
+		inserted = append(inserted, r)
+	}
+	resp.ModifiedCount = len(inserted)
+	resp.Status = status(len(inserted), len(resp.DataErrors))
+	if err := addProcessed(resp, x[0], inserted); err != nil {
+		return nil, err
+	}
+	return decode(resp, data)
+}
+
+// checkVersion returns false if onlyIfCurrent is set, and the record
+// version is not one of the given versions
+func checkVersion(r *record, onlyIfCurrent bool, versions []string) bool {
+	if !onlyIfCurrent {
+		return true
+	}
+	v := r.documentVersion()
+	for _, x := range versions {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Save replaces documents with the same _id. If Upsert is set,
+// documents that do not exist are inserted. If IfCurrentOnly is set,
+// documents whose version is not in DocumentVersions fail with a
+// concurrent update data error
+func (c *Client) Save(request *lbclient.SaveRequest, data interface{}) (*lbclient.Response, error) {
+	return c.SaveContext(context.Background(), request, data)
+}
+
+// SaveContext replaces documents. See Save
+func (c *Client) SaveContext(ctx context.Context, request *lbclient.SaveRequest, data interface{}) (*lbclient.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := &request.RequestHeader
+	if errs := c.nextFailure(lbclient.CRUD_SAVE); errs != nil {
+		return decode(c.errorResponse(h, errs...), data)
+	}
+	var p interface{}
+	if request.P != nil {
+		p = request.P
+	}
+	x, err := expressions(p)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := parseDocs(request.DocData)
+	if err != nil || len(docs) == 0 {
+		return decode(c.errorResponse(h, crudError(lbclient.ERR_CRUD_REQUIRED, "save", "data")), data)
+	}
+	key := c.key(h.EntityName, h.EntityVersion)
+	resp := c.newResponse(h)
+	var saved []*record
+	for _, d := range docs {
+		i := -1
+		if _, ok := d["_id"]; ok {
+			i = c.find(c.collections[key], d["_id"])
+		}
+		if i < 0 {
+			if !request.Upsert {
+				resp.DataErrors = append(resp.DataErrors, dataError(d, lbclient.ERR_MONGO_SAVE, "save", "Document not found"))
+				continue
+			}
+			c.assignId(d)
+			r := &record{doc: d, version: 1}
+			c.collections[key] = append(c.collections[key], r)
+			saved = append(saved, r)
+			continue
+		}
+		r := c.collections[key][i]
+		if !checkVersion(r, request.IfCurrentOnly, request.DocumentVersions) {
+			resp.DataErrors = append(resp.DataErrors, dataError(d, lbclient.ERR_CRUD_CONCURRENT_UPDATE, "save", r.documentVersion()))
+			continue
+		}
+		r.doc = d
+		r.version++
+		saved = append(saved, r)
+	}
+	resp.ModifiedCount = len(saved)
+	resp.MatchCount = len(saved)
+	resp.Status = status(len(saved), len(resp.DataErrors))
+	if err := addProcessed(resp, x[0], saved); err != nil {
+		return nil, err
+	}
+	return decode(resp, data)
+}
+
+// Update applies the update expression to the documents matching the
+// query. If IfCurrentOnly is set, documents whose version is not in
+// DocumentVersions fail with a concurrent update data error
+func (c *Client) Update(request *lbclient.UpdateRequest, data interface{}) (*lbclient.Response, error) {
+	return c.UpdateContext(context.Background(), request, data)
+}
+
+// UpdateContext applies an update expression. See Update
+func (c *Client) UpdateContext(ctx context.Context, request *lbclient.UpdateRequest, data interface{}) (*lbclient.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := &request.RequestHeader
+	if errs := c.nextFailure(lbclient.CRUD_UPDATE); errs != nil {
+		return decode(c.errorResponse(h, errs...), data)
+	}
+	if request.Q == nil {
+		return decode(c.errorResponse(h, crudError(lbclient.ERR_CRUD_REQUIRED, "update", "query")), data)
+	}
+	if request.U == nil {
+		return decode(c.errorResponse(h, crudError(lbclient.ERR_CRUD_REQUIRED, "update", "update")), data)
+	}
+	var p interface{}
+	if request.P != nil {
+		p = request.P
+	}
+	x, err := expressions(request.Q, request.U, p)
+	if err != nil {
+		return nil, err
+	}
+	matching, err := c.match(c.collections[c.key(h.EntityName, h.EntityVersion)], x[0])
+	if err != nil {
+		return decode(c.errorResponse(h, crudError(lbclient.ERR_CRUD, "update", err.Error())), data)
+	}
+	resp := c.newResponse(h)
+	resp.MatchCount = len(matching)
+	var updated []*record
+	for _, r := range matching {
+		if !checkVersion(r, request.IfCurrentOnly, request.DocumentVersions) {
+			resp.DataErrors = append(resp.DataErrors, dataError(r.doc, lbclient.ERR_CRUD_CONCURRENT_UPDATE, "update", r.documentVersion()))
+			continue
+		}
+		doc := eval.DeepCopy(r.doc)
+		if err := eval.Apply(x[1], doc); err != nil {
+			resp.DataErrors = append(resp.DataErrors, dataError(r.doc, lbclient.ERR_MONGO_UPDATE, "update", err.Error()))
+			continue
+		}
+		r.doc = doc
+		r.version++
+		updated = append(updated, r)
+	}
+	resp.ModifiedCount = len(updated)
+	resp.Status = status(len(updated), len(resp.DataErrors))
+	if err := addProcessed(resp, x[2], updated); err != nil {
+		return nil, err
+	}
+	return decode(resp, data)
+}
+
+// Delete removes the documents matching the query
+func (c *Client) Delete(request *lbclient.DeleteRequest) (*lbclient.Response, error) {
+	return c.DeleteContext(context.Background(), request)
+}
+
+// DeleteContext removes the documents matching the query
+func (c *Client) DeleteContext(ctx context.Context, request *lbclient.DeleteRequest) (*lbclient.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := &request.RequestHeader
+	if errs := c.nextFailure(lbclient.CRUD_DELETE); errs != nil {
+		return decode(c.errorResponse(h, errs...), nil)
+	}
+	if request.Q == nil {
+		return decode(c.errorResponse(h, crudError(lbclient.ERR_CRUD_REQUIRED, "delete", "query")), nil)
+	}
+	x, err := expressions(request.Q)
+	if err != nil {
+		return nil, err
+	}
+	key := c.key(h.EntityName, h.EntityVersion)
+	remaining := make([]*record, 0, len(c.collections[key]))
+	for _, r := range c.collections[key] {
+		ok, err := eval.Matches(x[0], r.doc)
+		if err != nil {
+			return decode(c.errorResponse(h, crudError(lbclient.ERR_CRUD, "delete", err.Error())), nil)
+		}
+		if !ok {
+			remaining = append(remaining, r)
+		}
+	}
+	resp := c.newResponse(h)
+	resp.Status = lbclient.COMPLETE
+	resp.ModifiedCount = len(c.collections[key]) - len(remaining)
+	c.collections[key] = remaining
+	return decode(resp, nil)
+}
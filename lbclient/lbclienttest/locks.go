@@ -0,0 +1,228 @@
+package lbclienttest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lightblue-platform/go-client/lbclient"
+)
+
+// Locks is an in-memory lbclient.ContextLockingClient. Locks are
+// reentrant for the same caller id, and expire after their TTL the
+// way lightblue locks do. Failures can be injected using FailAcquire,
+// FailRelease, FailPing, BlockPing and BlockRelease. It can be shared
+// by multiple goroutines.
+type Locks struct {
+	mu            sync.Mutex
+	locks         map[lockKey]*heldLock
+	acquireErrors []error
+	releaseError  error
+	pingError     error
+	blockPing     bool
+	blockRelease  bool
+	pings         int
+}
+
+type lockKey struct {
+	domain, resourceId string
+}
+
+// heldLock is a lock held by a caller
+type heldLock struct {
+	callerId string
+	count    int
+	ttl      time.Duration
+	expires  time.Time
+}
+
+var _ lbclient.ContextLockingClient = &Locks{}
+
+// NewLocks returns an empty in-memory locking client
+func NewLocks() *Locks {
+	return &Locks{locks: make(map[lockKey]*heldLock)}
+}
+
+// get returns the lock of resourceId in domain, or nil if it is not
+// held or expired. It is called with l.mu locked
+func (l *Locks) get(domain, resourceId string) *heldLock {
+	k := lockKey{domain, resourceId}
+	h := l.locks[k]
+	if h != nil && time.Now().After(h.expires) {
+		delete(l.locks, k)
+		return nil
+	}
+	return h
+}
+
+// Acquire acquires the lock for callerId, or increments its count
+// if callerId holds it already. It returns false if the lock is held
+// by another caller
+func (l *Locks) Acquire(domain, callerId, resourceId string, ttl int) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.acquireErrors) > 0 {
+		err := l.acquireErrors[0]
+		l.acquireErrors = l.acquireErrors[1:]
+		return false, err
+	}
+	h := l.get(domain, resourceId)
+	if h == nil {
+		h = &heldLock{callerId: callerId}
+		l.locks[lockKey{domain, resourceId}] = h
+	} else if h.callerId != callerId {
+		return false, nil
+	}
+	h.count++
+	h.ttl = time.Duration(ttl) * time.Millisecond
+	h.expires = time.Now().Add(h.ttl)
+	return true, nil
+}
+
+// AcquireContext acquires the lock. See Acquire
+func (l *Locks) AcquireContext(ctx context.Context, domain, callerId, resourceId string, ttl int) (bool, error) {
+	return l.Acquire(domain, callerId, resourceId, ttl)
+}
+
+// Release decrements the lock count of callerId, and releases the
+// lock when it reaches zero
+func (l *Locks) Release(domain, callerId, resourceId string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.releaseError != nil {
+		return false, l.releaseError
+	}
+	h := l.get(domain, resourceId)
+	if h == nil || h.callerId != callerId {
+		return false, nil
+	}
+	if h.count--; h.count == 0 {
+		delete(l.locks, lockKey{domain, resourceId})
+	}
+	return true, nil
+}
+
+// ReleaseContext releases the lock like Release. While BlockRelease
+// is set, it blocks until ctx is done instead
+func (l *Locks) ReleaseContext(ctx context.Context, domain, callerId, resourceId string) (bool, error) {
+	l.mu.Lock()
+	block := l.blockRelease
+	l.mu.Unlock()
+	if block {
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+	return l.Release(domain, callerId, resourceId)
+}
+
+// GetLockCount returns the lock count of callerId, or 0 if it does
+// not hold the lock
+func (l *Locks) GetLockCount(domain, callerId, resourceId string) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	h := l.get(domain, resourceId)
+	if h == nil || h.callerId != callerId {
+		return 0, nil
+	}
+	return h.count, nil
+}
+
+// GetLockCountContext returns the lock count. See GetLockCount
+func (l *Locks) GetLockCountContext(ctx context.Context, domain, callerId, resourceId string) (int, error) {
+	return l.GetLockCount(domain, callerId, resourceId)
+}
+
+// Ping extends the lock of callerId by its TTL. It returns false if
+// callerId does not hold the lock
+func (l *Locks) Ping(domain, callerId, resourceId string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pings++
+	if l.pingError != nil {
+		return false, l.pingError
+	}
+	h := l.get(domain, resourceId)
+	if h == nil || h.callerId != callerId {
+		return false, nil
+	}
+	h.expires = time.Now().Add(h.ttl)
+	return true, nil
+}
+
+// PingContext pings the lock like Ping. While BlockPing is set, it
+// blocks until ctx is done instead
+func (l *Locks) PingContext(ctx context.Context, domain, callerId, resourceId string) (bool, error) {
+	l.mu.Lock()
+	block := l.blockPing
+	if block {
+		l.pings++
+	}
+	l.mu.Unlock()
+	if block {
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+	return l.Ping(domain, callerId, resourceId)
+}
+
+// FailAcquire makes the next acquire calls return errs, in order
+func (l *Locks) FailAcquire(errs ...error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.acquireErrors = append(l.acquireErrors, errs...)
+}
+
+// FailRelease makes release calls return err, until it is called
+// with nil
+func (l *Locks) FailRelease(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.releaseError = err
+}
+
+// FailPing makes ping calls return err, until it is called with nil
+func (l *Locks) FailPing(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pingError = err
+}
+
+// BlockPing sets whether PingContext blocks until its context is done
+func (l *Locks) BlockPing(block bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.blockPing = block
+}
+
+// BlockRelease sets whether ReleaseContext blocks until its context
+// is done
+func (l *Locks) BlockRelease(block bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.blockRelease = block
+}
+
+// Pings returns the number of ping calls
+func (l *Locks) Pings() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.pings
+}
+
+// Expire removes the lock of resourceId in domain, as if it expired
+func (l *Locks) Expire(domain, resourceId string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.locks, lockKey{domain, resourceId})
+}
+
+// Owner returns the caller id holding the lock of resourceId in
+// domain, or an empty string if the lock is not held
+func (l *Locks) Owner(domain, resourceId string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if h := l.get(domain, resourceId); h != nil {
+		return h.callerId
+	}
+	return ""
+}
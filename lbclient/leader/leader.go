@@ -0,0 +1,299 @@
+// Package leader elects a single active instance among a set of
+// instances, using a lightblue lock. The instance holding the lock is
+// the leader, and keeps the lock by renewing it using Ping.
+package leader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lightblue-platform/go-client/lbclient"
+)
+
+// Config configures an Elector
+type Config struct {
+	// The locking client
+	Client lbclient.LockingClient
+	// The lock domain and resource id. All the instances campaigning
+	// for the same resource must use the same domain and resource id
+	Domain     string
+	ResourceId string
+	// Identity of this instance, used as the lock caller id. It must
+	// be unique among the instances. If empty, lbclient.NewCallerId is
+	// used
+	Identity string
+	// Lock timeout. If zero, 30s is used
+	TTL time.Duration
+	// Interval between renewals while leading. If zero, TTL/3 is used
+	RenewInterval time.Duration
+	// Interval between attempts to acquire the lock while another
+	// instance is leading, or after an error. If zero, RenewInterval
+	// is used
+	RetryInterval time.Duration
+	// How long renewal errors are tolerated before leadership is given
+	// up, counted from the start of the last successful call. Calls
+	// that do not complete by then are cancelled. It must be less than
+	// TTL, so the leader steps down before another instance can
+	// acquire the lock. If zero, TTL minus RenewInterval is used
+	GracePeriod time.Duration
+	// OnStartedLeading is called in a new goroutine when the instance
+	// becomes the leader. ctx is cancelled when leadership is lost, and
+	// the lock is released after OnStartedLeading returns. If
+	// OnStartedLeading returns while leading, the instance steps down
+	// and campaigns again
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading is called after leadership is lost and
+	// OnStartedLeading returned
+	OnStoppedLeading func()
+}
+
+// Status is the state of an Elector, for health endpoints
+type Status struct {
+	// Identity of the instance
+	Identity string `json:"identity"`
+	// Leader is true while the instance is the leader
+	Leader bool `json:"leader"`
+	// Time the instance became the leader
+	LeaderSince time.Time `json:"leaderSince"`
+	// Start time of the last successful acquisition or renewal of the
+	// lock
+	LastRenewal time.Time `json:"lastRenewal"`
+	// The last error calling the lock service, cleared by the next
+	// successful call
+	LastError string `json:"lastError,omitempty"`
+}
+
+// Elector campaigns for leadership
+type Elector struct {
+	config Config
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New returns an Elector using config, after setting the defaults of
+// config and validating it
+func New(config Config) (*Elector, error) {
+	if config.Client == nil {
+		return nil, fmt.Errorf("Missing locking client")
+	}
+	if len(config.Domain) == 0 || len(config.ResourceId) == 0 {
+		return nil, fmt.Errorf("Missing lock domain or resource id")
+	}
+	if len(config.Identity) == 0 {
+		config.Identity = lbclient.NewCallerId()
+	}
+	if config.TTL <= 0 {
+		config.TTL = 30 * time.Second
+	}
+	if config.RenewInterval <= 0 {
+		config.RenewInterval = config.TTL / 3
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = config.RenewInterval
+	}
+	if config.GracePeriod <= 0 {
+		config.GracePeriod = config.TTL - config.RenewInterval
+	}
+	if config.RenewInterval >= config.TTL {
+		return nil, fmt.Errorf("Renew interval %s must be less than TTL %s", config.RenewInterval, config.TTL)
+	}
+	if config.GracePeriod >= config.TTL {
+		return nil, fmt.Errorf("Grace period %s must be less than TTL %s", config.GracePeriod, config.TTL)
+	}
+	return &Elector{config: config, status: Status{Identity: config.Identity}}, nil
+}
+
+// Status returns the current state of the elector
+func (e *Elector) Status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.status
+}
+
+// IsLeader returns if the instance is currently the leader
+func (e *Elector) IsLeader() bool {
+	return e.Status().Leader
+}
+
+// Run campaigns for leadership until ctx is done, and returns the
+// context error. When leadership is lost, the instance campaigns
+// again. Run must not be called concurrently
+func (e *Elector) Run(ctx context.Context) error {
+	for {
+		acquired, ok := e.campaign(ctx)
+		if !ok {
+			return ctx.Err()
+		}
+		e.lead(ctx, acquired)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := sleep(ctx, e.config.RetryInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// campaign tries to acquire the lock until it succeeds, or ctx is
+// done. It returns when the successful acquire call started
+func (e *Elector) campaign(ctx context.Context) (time.Time, bool) {
+	for {
+		start := time.Now()
+		callCtx, cancel := context.WithDeadline(ctx, start.Add(e.config.GracePeriod))
+		ok, err := e.acquire(callCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return time.Time{}, false
+		}
+		e.called(start, ok, err)
+		if ok {
+			return start, true
+		}
+		if sleep(ctx, e.config.RetryInterval) != nil {
+			return time.Time{}, false
+		}
+	}
+}
+
+// lead runs OnStartedLeading and renews the lock acquired at
+// acquired until leadership is lost or ctx is done
+func (e *Elector) lead(ctx context.Context, acquired time.Time) {
+	e.mu.Lock()
+	e.status.Leader = true
+	e.status.LeaderSince = time.Now()
+	e.mu.Unlock()
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if e.config.OnStartedLeading != nil {
+			e.config.OnStartedLeading(leaderCtx)
+		}
+	}()
+
+	held := e.renew(leaderCtx, done, acquired)
+	cancel()
+	<-done
+	if held {
+		e.release()
+	}
+	e.mu.Lock()
+	e.status.Leader = false
+	e.status.LeaderSince = time.Time{}
+	e.mu.Unlock()
+	if e.config.OnStoppedLeading != nil {
+		e.config.OnStoppedLeading()
+	}
+}
+
+// renew pings the lock until ctx is done, OnStartedLeading returns
+// (done is closed), or the lock is lost. It returns if the lock may
+// still be held. renewed is when the last successful call started.
+// Each ping is bounded by the end of the grace period after renewed,
+// so a hung ping cannot keep the instance leading after the lock
+// expired. After a failed ping, leadership ends at the end of the
+// grace period, without waiting for the next renewal. Pings of a
+// client that is not a ContextLockingClient cannot be bounded
+func (e *Elector) renew(ctx context.Context, done <-chan struct{}, renewed time.Time) bool {
+	ticker := time.NewTicker(e.config.RenewInterval)
+	defer ticker.Stop()
+	// deadline fires at the end of the grace period after a failure
+	var deadline <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case <-done:
+			return true
+		case <-deadline:
+			return true
+		case <-ticker.C:
+		}
+		start := time.Now()
+		callCtx, cancel := context.WithDeadline(ctx, renewed.Add(e.config.GracePeriod))
+		ok, err := e.ping(callCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return true
+		}
+		e.called(start, ok, err)
+		switch {
+		case err == nil && ok:
+			renewed = start
+			deadline = nil
+		case err == nil:
+			return false
+		case !time.Now().Before(renewed.Add(e.config.GracePeriod)):
+			return true
+		case deadline == nil:
+			deadline = time.After(time.Until(renewed.Add(e.config.GracePeriod)))
+		}
+	}
+}
+
+// called records the result of a call to acquire or renew the lock,
+// started at start
+func (e *Elector) called(start time.Time, ok bool, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		e.status.LastError = err.Error()
+		return
+	}
+	e.status.LastError = ""
+	if ok {
+		e.status.LastRenewal = start
+	}
+}
+
+func (e *Elector) acquire(ctx context.Context) (bool, error) {
+	c := e.config
+	ttl := int(c.TTL / time.Millisecond)
+	if cc, ok := c.Client.(lbclient.ContextLockingClient); ok {
+		return cc.AcquireContext(ctx, c.Domain, c.Identity, c.ResourceId, ttl)
+	}
+	return c.Client.Acquire(c.Domain, c.Identity, c.ResourceId, ttl)
+}
+
+func (e *Elector) ping(ctx context.Context) (bool, error) {
+	c := e.config
+	if cc, ok := c.Client.(lbclient.ContextLockingClient); ok {
+		return cc.PingContext(ctx, c.Domain, c.Identity, c.ResourceId)
+	}
+	return c.Client.Ping(c.Domain, c.Identity, c.ResourceId)
+}
+
+// release releases the lock. It is not bounded by the context of Run,
+// which may be done
+func (e *Elector) release() {
+	c := e.config
+	var err error
+	if cc, ok := c.Client.(lbclient.ContextLockingClient); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), c.RenewInterval)
+		defer cancel()
+		_, err = cc.ReleaseContext(ctx, c.Domain, c.Identity, c.ResourceId)
+	} else {
+		_, err = c.Client.Release(c.Domain, c.Identity, c.ResourceId)
+	}
+	if err != nil {
+		e.mu.Lock()
+		e.status.LastError = err.Error()
+		e.mu.Unlock()
+	}
+}
+
+// sleep waits for d, or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
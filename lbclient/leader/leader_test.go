@@ -0,0 +1,272 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lightblue-platform/go-client/lbclient"
+	"github.com/lightblue-platform/go-client/lbclient/lbclienttest"
+)
+
+func testConfig(client lbclient.LockingClient, identity string) Config {
+	return Config{Client: client,
+		Domain:        "d",
+		ResourceId:    "r",
+		Identity:      identity,
+		TTL:           100 * time.Millisecond,
+		RenewInterval: 10 * time.Millisecond}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timeout waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestElection(t *testing.T) {
+	client := lbclienttest.NewLocks()
+	var mu sync.Mutex
+	leading := 0
+	started := make(chan string, 2)
+	electors := make(map[string]*Elector)
+	cancels := make(map[string]context.CancelFunc)
+	var wg sync.WaitGroup
+	for _, id := range []string{"a", "b"} {
+		id := id
+		cfg := testConfig(client, id)
+		cfg.OnStartedLeading = func(ctx context.Context) {
+			mu.Lock()
+			leading++
+			if leading > 1 {
+				t.Errorf("Two leaders")
+			}
+			mu.Unlock()
+			started <- id
+			<-ctx.Done()
+		}
+		cfg.OnStoppedLeading = func() {
+			mu.Lock()
+			leading--
+			mu.Unlock()
+		}
+		e, err := New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		electors[id], cancels[id] = e, cancel
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := e.Run(ctx); err != context.Canceled {
+				t.Errorf("Expected cancelled, got %v", err)
+			}
+		}()
+	}
+
+	first := <-started
+	second := "a"
+	if first == "a" {
+		second = "b"
+	}
+	time.Sleep(150 * time.Millisecond)
+	if !electors[first].IsLeader() || electors[second].IsLeader() || client.Owner("d", "r") != first {
+		t.Fatalf("Expected %s to lead: %+v %+v", first, electors[first].Status(), electors[second].Status())
+	}
+	if s := electors[first].Status(); s.Identity != first || s.LeaderSince.IsZero() || s.LastRenewal.IsZero() {
+		t.Errorf("Unexpected status: %+v", s)
+	}
+
+	// The second instance takes over when the leader stops
+	cancels[first]()
+	if got := <-started; got != second {
+		t.Errorf("Expected %s to lead, got %s", second, got)
+	}
+	waitFor(t, "leader state", func() bool { return electors[second].IsLeader() && !electors[first].IsLeader() })
+	cancels[second]()
+	wg.Wait()
+	if client.Owner("d", "r") != "" || leading != 0 {
+		t.Errorf("Lock not released: %s %d", client.Owner("d", "r"), leading)
+	}
+}
+
+func TestGracePeriod(t *testing.T) {
+	client := lbclienttest.NewLocks()
+	stopped := make(chan struct{})
+	cfg := testConfig(client, "a")
+	cfg.GracePeriod = 50 * time.Millisecond
+	cfg.OnStartedLeading = func(ctx context.Context) { <-ctx.Done() }
+	cfg.OnStoppedLeading = func() { close(stopped) }
+	e, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+	waitFor(t, "leadership", e.IsLeader)
+
+	// Short failures are tolerated
+	client.FailPing(errors.New("unavailable"))
+	time.Sleep(25 * time.Millisecond)
+	if !e.IsLeader() || e.Status().LastError != "unavailable" {
+		t.Errorf("Unexpected status: %+v", e.Status())
+	}
+	client.FailPing(nil)
+	waitFor(t, "recovery", func() bool { return e.Status().LastError == "" })
+
+	// Failures longer than the grace period end leadership
+	client.FailPing(errors.New("unavailable"))
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Leadership not lost")
+	}
+	if e.IsLeader() {
+		t.Error("Expected not leader")
+	}
+}
+
+func TestBlockedPing(t *testing.T) {
+	client := lbclienttest.NewLocks()
+	stopped := make(chan struct{})
+	cfg := testConfig(client, "a")
+	cfg.GracePeriod = 50 * time.Millisecond
+	cfg.OnStartedLeading = func(ctx context.Context) { <-ctx.Done() }
+	cfg.OnStoppedLeading = func() { close(stopped) }
+	e, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+	waitFor(t, "leadership", e.IsLeader)
+
+	// A ping that does not return must not keep the instance leading
+	// after the lock expires
+	client.BlockPing(true)
+	blocked := time.Now()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Leadership not lost")
+	}
+	if d := time.Since(blocked); d >= cfg.TTL {
+		t.Errorf("Leadership lost after %s, expected less than the TTL %s", d, cfg.TTL)
+	}
+	if s := e.Status(); s.Leader || s.LastError != context.DeadlineExceeded.Error() {
+		t.Errorf("Unexpected status: %+v", s)
+	}
+}
+
+// slowAcquire is a locking client whose acquire calls return after
+// delay
+type slowAcquire struct {
+	*lbclienttest.Locks
+	delay time.Duration
+}
+
+func (c slowAcquire) AcquireContext(ctx context.Context, domain, callerId, resourceId string, ttl int) (bool, error) {
+	time.Sleep(c.delay)
+	return c.Locks.AcquireContext(ctx, domain, callerId, resourceId, ttl)
+}
+
+func TestLateAcquire(t *testing.T) {
+	client := lbclienttest.NewLocks()
+	client.FailPing(errors.New("unavailable"))
+	started := make(chan time.Time, 1)
+	stopped := make(chan time.Time, 1)
+	cfg := testConfig(slowAcquire{client, 150 * time.Millisecond}, "a")
+	cfg.TTL = 400 * time.Millisecond
+	cfg.RenewInterval = 120 * time.Millisecond
+	cfg.GracePeriod = 300 * time.Millisecond
+	cfg.OnStartedLeading = func(ctx context.Context) {
+		select {
+		case started <- time.Now():
+		default:
+		}
+		<-ctx.Done()
+	}
+	cfg.OnStoppedLeading = func() {
+		select {
+		case stopped <- time.Now():
+		default:
+		}
+	}
+	e, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+
+	// The acquire call started 150ms before leading, so the grace
+	// period ends 150ms after leading, between the failed pings at
+	// 120ms and 240ms
+	start := <-started
+	select {
+	case end := <-stopped:
+		if d := end.Sub(start); d < 100*time.Millisecond || d > 200*time.Millisecond {
+			t.Errorf("Leadership lost after %s, expected the end of the grace period after 150ms", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Leadership not lost")
+	}
+}
+
+func TestLostLock(t *testing.T) {
+	client := lbclienttest.NewLocks()
+	stopped := make(chan struct{}, 1)
+	cfg := testConfig(client, "a")
+	cfg.OnStartedLeading = func(ctx context.Context) { <-ctx.Done() }
+	cfg.OnStoppedLeading = func() { stopped <- struct{}{} }
+	e, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go e.Run(ctx)
+	waitFor(t, "leadership", e.IsLeader)
+
+	// Another instance took the lock
+	client.Expire("d", "r")
+	if ok, _ := client.Acquire("d", "b", "r", int(time.Hour/time.Millisecond)); !ok {
+		t.Fatal("Expected b to acquire the lock")
+	}
+	<-stopped
+	if e.IsLeader() || client.Owner("d", "r") != "b" {
+		t.Errorf("Expected b to lead, got %+v", e.Status())
+	}
+}
+
+func TestConfig(t *testing.T) {
+	client := lbclienttest.NewLocks()
+	e, err := New(Config{Client: client, Domain: "d", ResourceId: "r"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.config.TTL != 30*time.Second || e.config.RenewInterval != 10*time.Second ||
+		e.config.GracePeriod != 20*time.Second || len(e.config.Identity) == 0 {
+		t.Errorf("Unexpected defaults: %+v", e.config)
+	}
+	for _, cfg := range []Config{
+		{Domain: "d", ResourceId: "r"},
+		{Client: client, ResourceId: "r"},
+		{Client: client, Domain: "d", ResourceId: "r", TTL: time.Second, RenewInterval: time.Second},
+		{Client: client, Domain: "d", ResourceId: "r", TTL: time.Second, GracePeriod: 2 * time.Second},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
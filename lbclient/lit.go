@@ -1,8 +1,15 @@
 package lbclient
 
 import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
 	"time"
 )
 
@@ -99,6 +106,165 @@ func LitNull() Literal {
 	return Literal{which: -1}
 }
 
+// LitOf makes a literal from a Go value:
+//
+//   - nil and nil pointers are null,
+//   - integers of all sizes, including int64 and uint64 values that do
+//     not fit into an int, are kept without loss,
+//   - float32 values, and float64 values that are exact in float32
+//     are doubles, other float64 values are kept with full precision,
+//   - time.Time, Date and valid NullDate values are dates, invalid
+//     NullDate values are null,
+//   - *big.Int and *big.Float values are kept with full precision,
+//   - []byte values are binary, encoded in base64,
+//   - pointers are dereferenced,
+//   - json.Marshaler and encoding.TextMarshaler values are encoded
+//     using their marshalers,
+//   - other values are JSON encoded.
+//
+// Types based on basic types, such as type Status string, are
+// treated as their basic types. LitOf returns an error for NaN,
+// infinite numbers, and values that cannot be JSON encoded
+func LitOf(v interface{}) (Literal, error) {
+	switch x := v.(type) {
+	case nil:
+		return LitNull(), nil
+	case Literal:
+		return x, nil
+	case time.Time:
+		return LitDate(x), nil
+	case *time.Time:
+		if x == nil {
+			return LitNull(), nil
+		}
+		return LitDate(*x), nil
+	case Date:
+		return LitDate(x.Time), nil
+	case NullDate:
+		if !x.Valid {
+			return LitNull(), nil
+		}
+		return LitDate(x.Time), nil
+	case *big.Int:
+		if x == nil {
+			return LitNull(), nil
+		}
+		return litNumber(x.String())
+	case *big.Float:
+		if x == nil {
+			return LitNull(), nil
+		}
+		if x.IsInf() {
+			return Literal{}, fmt.Errorf("Invalid literal: %s", x)
+		}
+		return litNumber(x.Text('g', -1))
+	case json.Marshaler:
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return LitNull(), nil
+		}
+		b, err := x.MarshalJSON()
+		if err != nil {
+			return Literal{}, err
+		}
+		var l Literal
+		err = l.UnmarshalJSON(b)
+		return l, err
+	case encoding.TextMarshaler:
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return LitNull(), nil
+		}
+		b, err := x.MarshalText()
+		if err != nil {
+			return Literal{}, err
+		}
+		return LitStr(string(b)), nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return LitNull(), nil
+		}
+		return LitOf(rv.Elem().Interface())
+	case reflect.Bool:
+		return LitBool(rv.Bool()), nil
+	case reflect.String:
+		return LitStr(rv.String()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := rv.Int()
+		if n >= math.MinInt && n <= math.MaxInt {
+			return LitInt(int(n)), nil
+		}
+		return litNumber(strconv.FormatInt(n, 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n := rv.Uint()
+		if n <= math.MaxInt {
+			return LitInt(int(n)), nil
+		}
+		return litNumber(strconv.FormatUint(n, 10))
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return Literal{}, fmt.Errorf("Invalid literal: %v", f)
+		}
+		if rv.Kind() == reflect.Float32 || float64(float32(f)) == f {
+			return LitDouble(float32(f)), nil
+		}
+		b, _ := json.Marshal(f)
+		return litNumber(string(b))
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			if rv.IsNil() {
+				return LitNull(), nil
+			}
+			return LitStr(base64.StdEncoding.EncodeToString(rv.Bytes())), nil
+		}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return Literal{}, err
+	}
+	var l Literal
+	err = l.UnmarshalJSON(b)
+	return l, err
+}
+
+// litNumber returns a literal for a number that may not fit into an
+// int or a float32
+func litNumber(s string) (Literal, error) {
+	var l Literal
+	if err := l.UnmarshalJSON([]byte(s)); err != nil {
+		return Literal{}, fmt.Errorf("Invalid number %s: %s", s, err)
+	}
+	return l, nil
+}
+
+// LitsOf makes literals from the elements of a slice or array using
+// LitOf. A nil slice returns an empty list
+func LitsOf(values interface{}) ([]Literal, error) {
+	rv := reflect.ValueOf(values)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("Expected slice or array, got %T", values)
+	}
+	ret := make([]Literal, rv.Len())
+	for i := range ret {
+		l, err := LitOf(rv.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("[%d]: %s", i, err)
+		}
+		ret[i] = l
+	}
+	return ret, nil
+}
+
+// rvalueOf returns v if it is an RValue, or LitOf(v) otherwise
+func rvalueOf(v interface{}) (RValue, error) {
+	if r, ok := v.(RValue); ok {
+		return r, nil
+	}
+	return LitOf(v)
+}
+
 // MarshalJSON returns JSON representation of a  literal value
 func (l Literal) MarshalJSON() ([]byte, error) {
 	switch l.which {
@@ -185,3 +351,74 @@ func (r ValueOf) MarshalJSON() ([]byte, error) {
 func (r ValueOf) String() string {
 	return fmt.Sprintf("{\"$valueof\":\"%s\"}", r.field)
 }
+
+// UnmarshalJSON decodes a literal value. Integers are decoded as
+// LitInt, other numbers as LitDouble, and objects, arrays and
+// integers that do not fit into an int are kept as raw JSON
+func (l *Literal) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case nil:
+		*l = LitNull()
+	case string:
+		*l = LitStr(t)
+	case bool:
+		*l = LitBool(t)
+	case json.Number:
+		if i, err := strconv.Atoi(string(t)); err == nil {
+			*l = LitInt(i)
+		} else if f, ok := exactFloat32(string(t)); ok {
+			*l = LitDouble(f)
+		} else {
+			*l = LitJson(append([]byte(nil), bytes.TrimSpace(data)...))
+		}
+	default:
+		*l = LitJson(append([]byte(nil), bytes.TrimSpace(data)...))
+	}
+	return nil
+}
+
+// exactFloat32 parses s as a float32, and returns true if the float32
+// is encoded as the same number, so it does not lose precision
+func exactFloat32(s string) (float32, bool) {
+	f64, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	f32 := float32(f64)
+	exact, ok1 := new(big.Rat).SetString(s)
+	back, ok2 := new(big.Rat).SetString(strconv.FormatFloat(float64(f32), 'g', -1, 32))
+	return f32, ok1 && ok2 && exact.Cmp(back) == 0
+}
+
+// UnmarshalJSON decodes a {"$valueof":field} construct
+func (r *ValueOf) UnmarshalJSON(data []byte) error {
+	m, err := jsonObject(data, "$valueof")
+	if err != nil {
+		return err
+	}
+	r.field, err = jsonString(m, "$valueof")
+	return err
+}
+
+// parseRValue decodes a literal value, or a {"$valueof":field}
+func parseRValue(data []byte) (RValue, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		if m, err := jsonObject(trimmed); err == nil {
+			if _, ok := m["$valueof"]; ok {
+				var v ValueOf
+				err := v.UnmarshalJSON(trimmed)
+				return v, err
+			}
+		}
+	}
+	var l Literal
+	err := l.UnmarshalJSON(trimmed)
+	return l, err
+}
@@ -2,6 +2,9 @@ package lbclient
 
 import (
 	"encoding/json"
+	"math"
+	"math/big"
+	"net"
 	"testing"
 	"time"
 )
@@ -38,3 +41,122 @@ func cmp(t *testing.T, expected string, v interface{}) {
 		t.Errorf("expected: %s got %s", expected, s)
 	}
 }
+
+type litStatus string
+
+type litPoint struct {
+	X int `json:"x"`
+}
+
+type litMarshaler struct{}
+
+func (litMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`"custom"`), nil
+}
+
+func TestLitOf(t *testing.T) {
+	date := time.Date(2017, 1, 2, 13, 14, 15, 123000000, time.UTC)
+	n := 5
+	var nilPtr *int
+	bf, _ := new(big.Float).SetPrec(200).SetString("1.00000000000000000000000001")
+	tests := []struct {
+		v        interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{LitStr("x"), `"x"`},
+		{true, "true"},
+		{"s", `"s"`},
+		{litStatus("active"), `"active"`},
+		{int8(-3), "-3"},
+		{uint16(7), "7"},
+		{int64(math.MaxInt64), "9223372036854775807"},
+		{uint64(math.MaxUint64), "18446744073709551615"},
+		{float32(1.5), "1.5"},
+		{0.1, "0.1"},
+		{123456789.123456789, "123456789.12345679"},
+		{date, `"20170102T13:14:15.123+0000"`},
+		{&date, `"20170102T13:14:15.123+0000"`},
+		{new(big.Int).Lsh(big.NewInt(1), 100), "1267650600228229401496703205376"},
+		{bf, "1.00000000000000000000000001"},
+		{[]byte("hello"), `"aGVsbG8="`},
+		{&n, "5"},
+		{nilPtr, "null"},
+		{litMarshaler{}, `"custom"`},
+		{net.ParseIP("10.0.0.1"), `"10.0.0.1"`},
+		{litPoint{X: 1}, `{"x":1}`},
+		{[]int{1, 2}, "[1,2]"},
+	}
+	for _, test := range tests {
+		l, err := LitOf(test.v)
+		if err != nil {
+			t.Errorf("%v: %s", test.v, err)
+			continue
+		}
+		if s := l.String(); s != test.expected {
+			t.Errorf("%v: expected %s, got %s", test.v, test.expected, s)
+		}
+	}
+	for _, v := range []interface{}{math.NaN(), math.Inf(1), make(chan int)} {
+		if _, err := LitOf(v); err == nil {
+			t.Errorf("Expected error for %v", v)
+		}
+	}
+}
+
+func TestLitsOf(t *testing.T) {
+	l, err := LitsOf([]interface{}{1, "a", nil, int64(math.MaxInt64)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmp(t, `[1,"a",null,9223372036854775807]`, l)
+	if l, err = LitsOf([2]float64{0.5, 0.1}); err != nil {
+		t.Fatal(err)
+	}
+	cmp(t, `[0.5,0.1]`, l)
+	if _, err := LitsOf(1); err == nil {
+		t.Errorf("Expected error for non-slice")
+	}
+	if _, err := LitsOf([]float64{math.NaN()}); err == nil {
+		t.Errorf("Expected error for NaN")
+	}
+}
+
+func mustQuery(q *Query, err error) *Query {
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func TestLitOfBuilders(t *testing.T) {
+	cmp(t, `{"field":"f","op":"=","rvalue":9223372036854775807}`, mustQuery(CmpValueOf("f", EQ, int64(math.MaxInt64))))
+	cmp(t, `{"field":"f","op":"$in","values":[1,2]}`, mustQuery(CmpValuesOf("f", IN, []uint64{1, 2})))
+	var u Update
+	if _, err := u.SetOf("a", 0.1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.SetOf("b", ValueOfField("c")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.AddOf("n", int64(1)); err != nil {
+		t.Fatal(err)
+	}
+	cmp(t, `[{"$set":{"a":0.1}},{"$set":{"b":{"$valueof":"c"}}},{"$add":{"n":1}}]`, u)
+
+	if _, err := CmpValueOf("f", EQ, math.NaN()); err == nil {
+		t.Errorf("Expected error for NaN")
+	}
+	if _, err := CmpValuesOf("f", IN, 1); err == nil {
+		t.Errorf("Expected error for non-slice")
+	}
+	if _, err := u.SetOf("x", make(chan int)); err == nil {
+		t.Errorf("Expected error for channel")
+	}
+	if _, err := u.AddOf("x", math.Inf(1)); err == nil {
+		t.Errorf("Expected error for Inf")
+	}
+	if len(u.u) != 3 {
+		t.Errorf("Update changed after error: %d parts", len(u.u))
+	}
+}
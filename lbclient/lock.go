@@ -0,0 +1,236 @@
+package lbclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrLockNotAcquired is returned by TryAcquireLock if the lock is
+	// held by another caller
+	ErrLockNotAcquired = errors.New("lock not acquired")
+	// ErrLockLost is the error of a Lock that could not be renewed
+	ErrLockLost = errors.New("lock lost")
+)
+
+// LockOptions controls how AcquireLock acquires and renews a lock
+type LockOptions struct {
+	// Interval between renewals. If zero, the lock is renewed three
+	// times per TTL
+	RenewInterval time.Duration
+	// Time to wait before the first retry if the lock is held by
+	// another caller. If zero, 100ms is used
+	PollInterval time.Duration
+	// Maximum time to wait between retries. The wait is doubled after
+	// each retry until it reaches MaxPollInterval. If zero, 5s is used
+	MaxPollInterval time.Duration
+}
+
+func (o *LockOptions) renewInterval(ttl time.Duration) time.Duration {
+	if o != nil && o.RenewInterval > 0 {
+		return o.RenewInterval
+	}
+	return ttl / 3
+}
+
+func (o *LockOptions) pollPolicy() *RetryPolicy {
+	p := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 5 * time.Second, Multiplier: 2, Jitter: 0.2}
+	if o != nil && o.PollInterval > 0 {
+		p.InitialBackoff = o.PollInterval
+	}
+	if o != nil && o.MaxPollInterval > 0 {
+		p.MaxBackoff = o.MaxPollInterval
+	}
+	return p
+}
+
+// Lock is a lightblue lock held by a caller. The lock is renewed in
+// the background until it is closed, the context it was acquired
+// with is done, or renewal fails. Lost returns a channel that is
+// closed when the lock is no longer held.
+//
+//	lock, err := lbclient.AcquireLock(ctx, cli, "jobs", host, "nightly", time.Minute, nil)
+//	if err != nil {
+//		return err
+//	}
+//	defer lock.Close()
+//	select {
+//	case <-lock.Lost():
+//		return lock.Err()
+//	case result := <-work:
+//		...
+//	}
+type Lock struct {
+	client     LockingClient
+	domain     string
+	callerId   string
+	resourceId string
+
+	cancel context.CancelFunc
+	lost   chan struct{}
+	done   chan struct{}
+
+	mu         sync.Mutex
+	err        error
+	releaseErr error
+}
+
+// AcquireLock acquires the lock for resourceId in domain on behalf of
+// callerId, waiting while the lock is held by another caller. The
+// wait is bounded by ctx, and the lock is also released when ctx is
+// done. ttl is the lock timeout, which is renewed using Ping before
+// it expires. If opts is nil, default options are used. If client is
+// a ContextLockingClient, the calls use contexts
+func AcquireLock(ctx context.Context, client LockingClient, domain, callerId, resourceId string, ttl time.Duration, opts *LockOptions) (*Lock, error) {
+	policy := opts.pollPolicy()
+	for retry := 1; ; retry++ {
+		l, err := TryAcquireLock(ctx, client, domain, callerId, resourceId, ttl, opts)
+		if err != ErrLockNotAcquired {
+			return l, err
+		}
+		if err := sleep(ctx, policy.Backoff(retry)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// TryAcquireLock acquires the lock like AcquireLock, but returns
+// ErrLockNotAcquired without waiting if the lock is held by another
+// caller
+func TryAcquireLock(ctx context.Context, client LockingClient, domain, callerId, resourceId string, ttl time.Duration, opts *LockOptions) (*Lock, error) {
+	return tryAcquireLock(ctx, ctx, client, domain, callerId, resourceId, ttl, opts)
+}
+
+// tryAcquireLock acquires the lock using ctx for the acquire call. The
+// lock is released when parent is done
+func tryAcquireLock(ctx, parent context.Context, client LockingClient, domain, callerId, resourceId string, ttl time.Duration, opts *LockOptions) (*Lock, error) {
+	interval := opts.renewInterval(ttl)
+	if interval <= 0 {
+		return nil, fmt.Errorf("Invalid lock TTL: %s", ttl)
+	}
+	// The lease starts before the call, so it is not overestimated
+	acquired := time.Now()
+	var ok bool
+	var err error
+	if c, isCtx := client.(ContextLockingClient); isCtx {
+		ok, err = c.AcquireContext(ctx, domain, callerId, resourceId, int(ttl/time.Millisecond))
+	} else {
+		ok, err = client.Acquire(domain, callerId, resourceId, int(ttl/time.Millisecond))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLockNotAcquired
+	}
+	l := &Lock{client: client,
+		domain:     domain,
+		callerId:   callerId,
+		resourceId: resourceId,
+		lost:       make(chan struct{}),
+		done:       make(chan struct{})}
+	var renewCtx context.Context
+	renewCtx, l.cancel = context.WithCancel(parent)
+	go l.renew(parent, renewCtx, acquired, ttl, interval)
+	return l, nil
+}
+
+// Lost returns a channel that is closed when the lock is no longer
+// held, because it could not be renewed, it was closed, or the
+// context it was acquired with is done
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Err returns why the lock is no longer held: nil while the lock is
+// held or after Close, an error wrapping ErrLockLost if it could not
+// be renewed, or the context error if the context is done
+func (l *Lock) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Close stops renewing the lock and releases it. Close returns the
+// error of the release call, and can be called multiple times
+func (l *Lock) Close() error {
+	l.cancel()
+	<-l.done
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.releaseErr
+}
+
+// renew pings the lock every interval until ctx is done, and then
+// releases it. ctx is done when the lock is closed, or when parent,
+// the context the lock was acquired with, is done. A failed ping is
+// retried until the lock expires. Each ping is bounded by the time
+// left on the lease, which starts when the last successful call
+// started. Pings of a client that is not a ContextLockingClient
+// cannot be bounded
+func (l *Lock) renew(parent, ctx context.Context, renewed time.Time, ttl, interval time.Duration) {
+	defer close(l.done)
+	defer close(l.lost)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			l.release(parent, ttl)
+			return
+		case <-ticker.C:
+		}
+		start := time.Now()
+		pingCtx, cancel := context.WithDeadline(ctx, renewed.Add(ttl))
+		ok, err := l.ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			l.release(parent, ttl)
+			return
+		}
+		switch {
+		case err == nil && ok:
+			renewed = start
+		case err == nil:
+			l.setErr(ErrLockLost)
+			return
+		case time.Since(renewed)+interval >= ttl:
+			l.setErr(fmt.Errorf("%w: %s", ErrLockLost, err))
+			return
+		}
+	}
+}
+
+func (l *Lock) ping(ctx context.Context) (bool, error) {
+	if c, ok := l.client.(ContextLockingClient); ok {
+		return c.PingContext(ctx, l.domain, l.callerId, l.resourceId)
+	}
+	return l.client.Ping(l.domain, l.callerId, l.resourceId)
+}
+
+// release releases the lock. The release call is not bounded by
+// parent, whose error is recorded as the reason the lock is no
+// longer held, but by ttl, after which the lock expires anyway
+func (l *Lock) release(parent context.Context, ttl time.Duration) {
+	var err error
+	if c, ok := l.client.(ContextLockingClient); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), ttl)
+		defer cancel()
+		_, err = c.ReleaseContext(ctx, l.domain, l.callerId, l.resourceId)
+	} else {
+		_, err = l.client.Release(l.domain, l.callerId, l.resourceId)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.releaseErr = err
+	l.err = parent.Err()
+}
+
+func (l *Lock) setErr(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.err = err
+}
@@ -0,0 +1,170 @@
+package lbclient_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lightblue-platform/go-client/lbclient"
+	"github.com/lightblue-platform/go-client/lbclient/lbclienttest"
+)
+
+// count returns the lock count of callerId
+func count(locks *lbclienttest.Locks, domain, callerId, resourceId string) int {
+	n, _ := locks.GetLockCount(domain, callerId, resourceId)
+	return n
+}
+
+func TestLockRenew(t *testing.T) {
+	locks := lbclienttest.NewLocks()
+	l, err := lbclient.AcquireLock(context.Background(), locks, "d", "c", "r", 60*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if count(locks, "d", "c", "r") != 1 {
+		t.Errorf("Lock not renewed")
+	}
+	select {
+	case <-l.Lost():
+		t.Errorf("Lock lost: %v", l.Err())
+	default:
+	}
+	if err := l.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Error(err)
+	}
+	<-l.Lost()
+	if count(locks, "d", "c", "r") != 0 || l.Err() != nil {
+		t.Errorf("Lock not released: %v", l.Err())
+	}
+}
+
+func TestLockWait(t *testing.T) {
+	locks := lbclienttest.NewLocks()
+	opts := &lbclient.LockOptions{PollInterval: time.Millisecond, MaxPollInterval: 5 * time.Millisecond}
+	first, err := lbclient.AcquireLock(context.Background(), locks, "d", "a", "r", time.Second, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lbclient.TryAcquireLock(context.Background(), locks, "d", "b", "r", time.Second, opts); err != lbclient.ErrLockNotAcquired {
+		t.Errorf("Expected not acquired, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := lbclient.AcquireLock(ctx, locks, "d", "b", "r", time.Second, opts); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		first.Close()
+	}()
+	second, err := lbclient.AcquireLock(context.Background(), locks, "d", "b", "r", time.Second, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	if count(locks, "d", "b", "r") != 1 {
+		t.Errorf("Expected lock held by b")
+	}
+}
+
+func TestLockLost(t *testing.T) {
+	locks := lbclienttest.NewLocks()
+	l, err := lbclient.AcquireLock(context.Background(), locks, "d", "c", "r", time.Second,
+		&lbclient.LockOptions{RenewInterval: 5 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	locks.Expire("d", "r")
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("Lock not lost")
+	}
+	if !errors.Is(l.Err(), lbclient.ErrLockLost) {
+		t.Errorf("Expected lock lost, got %v", l.Err())
+	}
+	if err := l.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLockPingError(t *testing.T) {
+	locks := lbclienttest.NewLocks()
+	locks.FailPing(errors.New("unavailable"))
+	l, err := lbclient.AcquireLock(context.Background(), locks, "d", "c", "r", 50*time.Millisecond,
+		&lbclient.LockOptions{RenewInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-l.Lost()
+	pings := locks.Pings()
+	if !errors.Is(l.Err(), lbclient.ErrLockLost) || pings < 2 {
+		t.Errorf("Expected lock lost after retries, got %v after %d pings", l.Err(), pings)
+	}
+}
+
+func TestLockPingBlocked(t *testing.T) {
+	locks := lbclienttest.NewLocks()
+	locks.BlockPing(true)
+	start := time.Now()
+	l, err := lbclient.AcquireLock(context.Background(), locks, "d", "c", "r", 50*time.Millisecond,
+		&lbclient.LockOptions{RenewInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-l.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("Lock not lost while the ping is blocked")
+	}
+	if !errors.Is(l.Err(), lbclient.ErrLockLost) {
+		t.Errorf("Expected lock lost, got %v", l.Err())
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("Lock lost after %s, expected the lease of 50ms", d)
+	}
+}
+
+func TestLockContextCancelRelease(t *testing.T) {
+	locks := lbclienttest.NewLocks()
+	ctx, cancel := context.WithCancel(context.Background())
+	l, err := lbclient.AcquireLock(ctx, locks, "d", "c", "r", time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	<-l.Lost()
+	if l.Err() != context.Canceled {
+		t.Errorf("Expected cancelled, got %v", l.Err())
+	}
+	if err := l.Close(); err != nil || count(locks, "d", "c", "r") != 0 {
+		t.Errorf("Lock not released: %v", err)
+	}
+}
+
+func TestLockReleaseBlocked(t *testing.T) {
+	locks := lbclienttest.NewLocks()
+	l, err := lbclient.AcquireLock(context.Background(), locks, "d", "c", "r", 50*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locks.BlockRelease(true)
+	start := time.Now()
+	if err := l.Close(); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("Release took %s, expected the TTL of 50ms", d)
+	}
+}
+
+func TestLockInvalidTTL(t *testing.T) {
+	if _, err := lbclient.AcquireLock(context.Background(), lbclienttest.NewLocks(), "d", "c", "r", 0, nil); err == nil {
+		t.Error("Expected error")
+	}
+}
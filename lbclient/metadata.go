@@ -0,0 +1,177 @@
+package lbclient
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// MetadataStatus is the status of an entity schema version
+type MetadataStatus string
+
+const (
+	ACTIVE     MetadataStatus = "active"
+	DEPRECATED MetadataStatus = "deprecated"
+	DISABLED   MetadataStatus = "disabled"
+)
+
+// EntityInfo is the version independent part of entity metadata.
+// Fields not known to the client are kept, and sent back when the
+// entity info is updated
+type EntityInfo struct {
+	Name           string `json:"name"`
+	DefaultVersion string `json:"defaultVersion,omitempty"`
+	// Indexes, enums, hooks and backend configuration are returned as raw JSON
+	Indexes   json.RawMessage `json:"indexes,omitempty"`
+	Enums     json.RawMessage `json:"enums,omitempty"`
+	Hooks     json.RawMessage `json:"hooks,omitempty"`
+	Backend   json.RawMessage `json:"backend,omitempty"`
+	DataStore json.RawMessage `json:"datastore,omitempty"`
+	// Fields of the entity info not known to the client
+	extra *map[string]interface{}
+}
+
+// Extra returns the fields of the entity info not known to the
+// client, such as entityConstraints, or nil if there are none
+func (e EntityInfo) Extra() map[string]interface{} {
+	return extraFields(e.extra)
+}
+
+// UnmarshalJSON decodes the entity info, keeping unknown fields in extra
+func (e *EntityInfo) UnmarshalJSON(data []byte) error {
+	type entityInfo EntityInfo
+	var x entityInfo
+	if err := unmarshalMetadata(data, &x, &x.extra); err != nil {
+		return err
+	}
+	*e = EntityInfo(x)
+	return nil
+}
+
+// MarshalJSON encodes the entity info, including the unknown fields
+func (e EntityInfo) MarshalJSON() ([]byte, error) {
+	type entityInfo EntityInfo
+	return marshalMetadata(entityInfo(e), e.extra)
+}
+
+// SchemaVersion contains the version of an entity schema
+type SchemaVersion struct {
+	Value           string   `json:"value"`
+	ExtendsVersions []string `json:"extendsVersions,omitempty"`
+	Changelog       string   `json:"changelog,omitempty"`
+}
+
+// SchemaStatusChange is an entry in the status change log of a schema
+type SchemaStatusChange struct {
+	Date    string         `json:"date,omitempty"`
+	Value   MetadataStatus `json:"value"`
+	Comment string         `json:"comment,omitempty"`
+}
+
+// SchemaStatus contains the current status and the status change log of a schema
+type SchemaStatus struct {
+	Value MetadataStatus       `json:"value"`
+	Log   []SchemaStatusChange `json:"log,omitempty"`
+}
+
+// EntitySchema is the versioned part of entity metadata. Fields not
+// known to the client are kept, and sent back when the schema is
+// created from a schema that was read
+type EntitySchema struct {
+	Name    string        `json:"name"`
+	Version SchemaVersion `json:"version"`
+	Status  SchemaStatus  `json:"status"`
+	// Access, fields and the rest of the schema are returned as raw JSON
+	Access     json.RawMessage `json:"access,omitempty"`
+	Fields     json.RawMessage `json:"fields,omitempty"`
+	Properties json.RawMessage `json:"properties,omitempty"`
+	// Fields of the schema not known to the client
+	extra *map[string]interface{}
+}
+
+// Extra returns the fields of the schema not known to the client, or
+// nil if there are none
+func (e EntitySchema) Extra() map[string]interface{} {
+	return extraFields(e.extra)
+}
+
+// UnmarshalJSON decodes the schema, keeping unknown fields in extra
+func (e *EntitySchema) UnmarshalJSON(data []byte) error {
+	type entitySchema EntitySchema
+	var x entitySchema
+	if err := unmarshalMetadata(data, &x, &x.extra); err != nil {
+		return err
+	}
+	*e = EntitySchema(x)
+	return nil
+}
+
+// MarshalJSON encodes the schema, including the unknown fields
+func (e EntitySchema) MarshalJSON() ([]byte, error) {
+	type entitySchema EntitySchema
+	return marshalMetadata(entitySchema(e), e.extra)
+}
+
+// EntityMetadata contains the entity info and the schema of an entity version
+type EntityMetadata struct {
+	EntityInfo EntityInfo   `json:"entityInfo"`
+	Schema     EntitySchema `json:"schema"`
+}
+
+// EntityVersion describes a version of an entity
+type EntityVersion struct {
+	Version         string         `json:"version"`
+	ExtendsVersions []string       `json:"extendsVersions,omitempty"`
+	Changelog       string         `json:"changelog,omitempty"`
+	Status          MetadataStatus `json:"status"`
+	DefaultVersion  bool           `json:"defaultVersion"`
+}
+
+// unmarshalMetadata decodes data into v, a pointer to a struct without
+// JSON methods, and adds the fields not in the json tags of the
+// struct to extra
+func unmarshalMetadata(data []byte, v interface{}, extra **map[string]interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	known := jsonFieldNames(reflect.TypeOf(v).Elem())
+	return decodeFields(data, extra, func(name string, value json.RawMessage) (bool, error) {
+		return known[name], nil
+	})
+}
+
+// marshalMetadata encodes v, a struct without JSON methods, and the
+// extra fields as a JSON object
+func marshalMetadata(v interface{}, extra *map[string]interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || extra == nil {
+		return data, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	known := make(map[string]interface{}, len(fields))
+	for k, x := range fields {
+		known[k] = x
+	}
+	return encodeFields(known, extra)
+}
+
+// jsonFieldNames returns the JSON names of the exported fields of a
+// struct type
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if len(f.PkgPath) > 0 {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if len(name) == 0 {
+			name = f.Name
+		}
+		names[name] = true
+	}
+	return names
+}
@@ -10,8 +10,10 @@ const (
 	SECONDARY_PREFERRED ReadPreference = "secondaryPreferred"
 )
 
+// MongoExecutionOptions are the execution options for the mongo
+// backend. Empty fields are not sent to the server
 type MongoExecutionOptions struct {
-	ReadPref     ReadPreference `json:"readPreference"`
-	WriteConcern string         `json:"writeConcern"`
-	MaxQueryTime int            `json:"maxQueryTimeMS:`
+	ReadPref     ReadPreference `json:"readPreference,omitempty"`
+	WriteConcern string         `json:"writeConcern,omitempty"`
+	MaxQueryTime int            `json:"maxQueryTimeMS,omitempty"`
 }
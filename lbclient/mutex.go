@@ -0,0 +1,285 @@
+package lbclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	processIdOnce sync.Once
+	processId     string
+	callerSeq     uint64
+)
+
+// NewCallerId returns a lock caller id unique to this process and
+// call: the host name, the process id, a random process token, and a
+// sequence number
+func NewCallerId() string {
+	processIdOnce.Do(func() {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "unknown"
+		}
+		token := make([]byte, 8)
+		rand.Read(token)
+		processId = host + "-" + strconv.Itoa(os.Getpid()) + "-" + hex.EncodeToString(token)
+	})
+	return processId + "-" + strconv.FormatUint(atomic.AddUint64(&callerSeq, 1), 10)
+}
+
+// DistributedMutex is a sync.Locker using a lightblue lock, so
+// critical sections can be guarded across processes. Lock, LockContext
+// and TryLock also exclude the other goroutines of the process using
+// the same mutex, like sync.Mutex. Each mutex has its own generated
+// caller id. A holder that locks the mutex again, for example in a
+// nested call, uses Reenter, which increments the hold count and the
+// reentrant lightblue lock count. Every Lock and Reenter is matched
+// by an Unlock. While locked, the lightblue lock is renewed in the
+// background as described for Lock.
+//
+// Create mutexes using NewDistributedMutex. TTL and Options can be
+// changed before the mutex is first used
+type DistributedMutex struct {
+	// Lock timeout. If zero, 30s is used
+	TTL time.Duration
+	// Options for renewing the lock, and polling while it is held by
+	// another caller
+	Options *LockOptions
+
+	client     LockingClient
+	domain     string
+	resourceId string
+	callerId   string
+
+	// sem is full while the mutex is locked
+	sem chan struct{}
+	// mu guards holds and lock
+	mu    sync.Mutex
+	holds int
+	lock  *Lock
+}
+
+var _ sync.Locker = &DistributedMutex{}
+
+// NewDistributedMutex returns a mutex for resourceId in domain using
+// the lightblue locks of client
+func NewDistributedMutex(client LockingClient, domain, resourceId string) *DistributedMutex {
+	return &DistributedMutex{client: client,
+		domain:     domain,
+		resourceId: resourceId,
+		callerId:   NewCallerId(),
+		sem:        make(chan struct{}, 1)}
+}
+
+// CallerId returns the lightblue caller id of the mutex
+func (m *DistributedMutex) CallerId() string {
+	return m.callerId
+}
+
+func (m *DistributedMutex) ttl() time.Duration {
+	if m.TTL > 0 {
+		return m.TTL
+	}
+	return 30 * time.Second
+}
+
+// Lock locks the mutex, waiting while it is locked by another
+// goroutine or another caller. Transient errors calling lightblue,
+// such as transport errors and HTTP 5xx responses, are retried until
+// the lock is acquired. Lock panics on other errors, which LockContext
+// returns
+func (m *DistributedMutex) Lock() {
+	m.sem <- struct{}{}
+	if err := m.acquire(context.Background(), true); err != nil {
+		<-m.sem
+		panic(fmt.Sprintf("lbclient: cannot lock DistributedMutex: %s", err))
+	}
+}
+
+// LockContext locks the mutex like Lock, but returns an error if ctx
+// is done before the lock is acquired, or if calling lightblue fails
+func (m *DistributedMutex) LockContext(ctx context.Context) error {
+	select {
+	case m.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := m.acquire(ctx, false); err != nil {
+		<-m.sem
+		return err
+	}
+	return nil
+}
+
+// TryLock tries to lock the mutex without waiting, and returns if it
+// succeeded. It fails if the mutex is locked, also by the calling
+// goroutine
+func (m *DistributedMutex) TryLock() bool {
+	select {
+	case m.sem <- struct{}{}:
+	default:
+		return false
+	}
+	l, err := tryAcquireLock(context.Background(), context.Background(), m.client, m.domain, m.callerId, m.resourceId, m.ttl(), m.Options)
+	if err != nil {
+		<-m.sem
+		return false
+	}
+	m.locked(l)
+	return true
+}
+
+// acquire acquires the lightblue lock, polling while it is held by
+// another caller. If retryErrors is set, transient errors are also
+// retried. It is called while sem is full
+func (m *DistributedMutex) acquire(ctx context.Context, retryErrors bool) error {
+	policy := m.Options.pollPolicy()
+	for retry := 1; ; retry++ {
+		l, err := tryAcquireLock(ctx, context.Background(), m.client, m.domain, m.callerId, m.resourceId, m.ttl(), m.Options)
+		if err == nil {
+			m.locked(l)
+			return nil
+		}
+		if err != ErrLockNotAcquired && !(retryErrors && isTransient(err)) {
+			return err
+		}
+		if err := sleep(ctx, policy.Backoff(retry)); err != nil {
+			return err
+		}
+	}
+}
+
+// Reenter locks the locked mutex again for its holder, incrementing
+// the hold count and the lightblue lock count of the caller id. It
+// must only be called while the calling goroutine holds the mutex,
+// and is matched by an Unlock. Errors calling lightblue are returned,
+// and not retried. It returns ErrLockLost if the lightblue lock could
+// not be renewed, or is held by another caller. It is a run-time
+// error if the mutex is not locked
+func (m *DistributedMutex) Reenter(ctx context.Context) error {
+	m.mu.Lock()
+	l := m.lock
+	m.mu.Unlock()
+	if l == nil {
+		panic("lbclient: reenter of unlocked DistributedMutex")
+	}
+	select {
+	case <-l.Lost():
+		return ErrLockLost
+	default:
+	}
+	ttl := int(m.ttl() / time.Millisecond)
+	var ok bool
+	var err error
+	if c, isCtx := m.client.(ContextLockingClient); isCtx {
+		ok, err = c.AcquireContext(ctx, m.domain, m.callerId, m.resourceId, ttl)
+	} else {
+		ok, err = m.client.Acquire(m.domain, m.callerId, m.resourceId, ttl)
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// The lock expired, and is held by another caller
+		return ErrLockLost
+	}
+	m.mu.Lock()
+	m.holds++
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *DistributedMutex) locked(l *Lock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lock, m.holds = l, 1
+}
+
+// isTransient returns true if err is ErrLockNotAcquired, or an error
+// calling lightblue that may succeed if retried: a transport error,
+// an HTTP 5xx response, or a mongo connection error
+func isTransient(err error) bool {
+	if err == ErrLockNotAcquired {
+		return true
+	}
+	var herr *HTTPError
+	if errors.As(err, &herr) {
+		return herr.StatusCode >= 500
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) {
+		return true
+	}
+	var rerr RequestError
+	return errors.As(err, &rerr) && rerr.ErrorCode == ERR_MONGO_CONNECTION
+}
+
+// Unlock decrements the hold count of the mutex. When it reaches
+// zero, the lightblue lock is released and the mutex can be locked by
+// other goroutines. Errors releasing the lock are ignored, the lock
+// expires after TTL. It is a run-time error if the mutex is not locked
+func (m *DistributedMutex) Unlock() {
+	m.UnlockContext(context.Background())
+}
+
+// UnlockContext unlocks the mutex like Unlock, and returns the error
+// of the release call. The hold count is decremented even if the
+// call fails
+func (m *DistributedMutex) UnlockContext(ctx context.Context) error {
+	m.mu.Lock()
+	holds, l := m.holds, m.lock
+	m.mu.Unlock()
+	if holds == 0 {
+		panic("lbclient: unlock of unlocked DistributedMutex")
+	}
+	if holds > 1 {
+		var err error
+		if c, ok := m.client.(ContextLockingClient); ok {
+			_, err = c.ReleaseContext(ctx, m.domain, m.callerId, m.resourceId)
+		} else {
+			_, err = m.client.Release(m.domain, m.callerId, m.resourceId)
+		}
+		m.mu.Lock()
+		m.holds--
+		m.mu.Unlock()
+		return err
+	}
+	err := l.Close()
+	m.mu.Lock()
+	m.lock, m.holds = nil, 0
+	m.mu.Unlock()
+	<-m.sem
+	return err
+}
+
+// Lost returns a channel that is closed if the lightblue lock of a
+// locked mutex could not be renewed, or nil if the mutex is not
+// locked
+func (m *DistributedMutex) Lost() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lock != nil {
+		return m.lock.Lost()
+	}
+	return nil
+}
+
+// LockCount returns the lightblue lock count of the caller id of the
+// mutex, or 0 if it is not locked or the lock expired. Clients that
+// retry lock calls, such as HttpClient, may count a retried call
+// twice, so the count can be higher than the hold count of the mutex
+func (m *DistributedMutex) LockCount(ctx context.Context) (int, error) {
+	if c, ok := m.client.(ContextLockingClient); ok {
+		return c.GetLockCountContext(ctx, m.domain, m.callerId, m.resourceId)
+	}
+	return m.client.GetLockCount(m.domain, m.callerId, m.resourceId)
+}
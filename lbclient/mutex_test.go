@@ -0,0 +1,247 @@
+package lbclient_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lightblue-platform/go-client/lbclient"
+	"github.com/lightblue-platform/go-client/lbclient/lbclienttest"
+)
+
+func TestDistributedMutex(t *testing.T) {
+	locks := lbclienttest.NewLocks()
+	opts := &lbclient.LockOptions{PollInterval: time.Millisecond, MaxPollInterval: 5 * time.Millisecond}
+	a := lbclient.NewDistributedMutex(locks, "d", "r")
+	b := lbclient.NewDistributedMutex(locks, "d", "r")
+	if a.CallerId() == b.CallerId() {
+		t.Errorf("Expected unique caller ids, got %s", a.CallerId())
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inside, counter := 0, 0
+	for i := 0; i < 10; i++ {
+		m := lbclient.NewDistributedMutex(locks, "d", "r")
+		m.Options = opts
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.Lock()
+			mu.Lock()
+			inside++
+			if inside > 1 {
+				t.Errorf("Mutual exclusion violated")
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			counter++
+			mu.Lock()
+			inside--
+			mu.Unlock()
+			m.Unlock()
+		}()
+	}
+	wg.Wait()
+	if counter != 10 {
+		t.Errorf("Expected 10, got %d", counter)
+	}
+	if n, _ := a.LockCount(context.Background()); n != 0 {
+		t.Errorf("Expected unlocked, got count %d", n)
+	}
+}
+
+func TestDistributedMutexGoroutines(t *testing.T) {
+	locks := lbclienttest.NewLocks()
+	m := lbclient.NewDistributedMutex(locks, "d", "r")
+	m.Options = &lbclient.LockOptions{PollInterval: time.Millisecond, MaxPollInterval: 5 * time.Millisecond}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inside, counter := 0, 0
+	for i := 0; i < 10; i++ {
+		withContext := i%2 == 1
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !withContext {
+				m.Lock()
+			} else if err := m.LockContext(context.Background()); err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			inside++
+			if inside > 1 {
+				t.Errorf("Mutual exclusion violated")
+			}
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			counter++
+			mu.Lock()
+			inside--
+			mu.Unlock()
+			if n, _ := m.LockCount(context.Background()); n != 1 {
+				t.Errorf("Expected count 1, got %d", n)
+			}
+			m.Unlock()
+		}()
+	}
+	wg.Wait()
+	if counter != 10 {
+		t.Errorf("Expected 10, got %d", counter)
+	}
+	if n, _ := m.LockCount(context.Background()); n != 0 {
+		t.Errorf("Expected unlocked, got count %d", n)
+	}
+}
+
+func TestDistributedMutexReentrant(t *testing.T) {
+	locks := lbclienttest.NewLocks()
+	a := lbclient.NewDistributedMutex(locks, "d", "r")
+	b := lbclient.NewDistributedMutex(locks, "d", "r")
+	count := func(expected int) {
+		t.Helper()
+		if n, err := a.LockCount(context.Background()); err != nil || n != expected {
+			t.Errorf("Expected count %d, got %d %v", expected, n, err)
+		}
+	}
+	a.Lock()
+	lost := a.Lost()
+	if err := a.Reenter(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Reenter(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	count(3)
+	if a.TryLock() || b.TryLock() {
+		t.Error("Expected locked by the holder")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := a.LockContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	a.Unlock()
+	if err := a.UnlockContext(context.Background()); err != nil {
+		t.Error(err)
+	}
+	count(1)
+	if a.Lost() != lost {
+		t.Error("Expected the same lock while held")
+	}
+	a.Unlock()
+	count(0)
+	if a.Lost() != nil {
+		t.Error("Expected unlocked")
+	}
+	if !b.TryLock() {
+		t.Error("Expected b to lock")
+	}
+	b.Unlock()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected panic")
+			}
+		}()
+		a.Reenter(context.Background())
+	}()
+}
+
+func TestDistributedMutexTryLock(t *testing.T) {
+	locks := lbclienttest.NewLocks()
+	a := lbclient.NewDistributedMutex(locks, "d", "r")
+	b := lbclient.NewDistributedMutex(locks, "d", "r")
+	if !a.TryLock() {
+		t.Fatal("Expected locked")
+	}
+	if b.TryLock() {
+		t.Error("Expected already locked")
+	}
+	if n, err := a.LockCount(context.Background()); err != nil || n != 1 {
+		t.Errorf("Expected count 1, got %d %v", n, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := b.LockContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	a.Unlock()
+	if err := b.LockContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if b.Lost() == nil || a.Lost() != nil {
+		t.Error("Unexpected lost channels")
+	}
+	b.Unlock()
+}
+
+func TestDistributedMutexErrors(t *testing.T) {
+	locks := lbclienttest.NewLocks()
+	m := lbclient.NewDistributedMutex(locks, "d", "r")
+	m.Options = &lbclient.LockOptions{PollInterval: time.Millisecond}
+
+	// Transient errors are retried by Lock
+	locks.FailAcquire(&lbclient.HTTPError{StatusCode: 503}, &url.Error{Op: "Post", URL: "http://lightblue", Err: io.EOF},
+		lbclient.RequestError{ErrorCode: lbclient.ERR_MONGO_CONNECTION})
+	m.Lock()
+	if n, _ := m.LockCount(context.Background()); n != 1 {
+		t.Errorf("Expected count 1, got %d", n)
+	}
+	m.Unlock()
+
+	// Other errors are returned by LockContext, and not retried by Lock
+	denied := &lbclient.HTTPError{StatusCode: 403}
+	locks.FailAcquire(denied, denied)
+	if err := m.LockContext(context.Background()); err != denied {
+		t.Errorf("Expected denied, got %v", err)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected panic")
+			}
+		}()
+		m.Lock()
+	}()
+	if m.Lost() != nil {
+		t.Error("Expected unlocked")
+	}
+
+	// Reenter does not retry errors
+	m.Lock()
+	locks.FailAcquire(&lbclient.HTTPError{StatusCode: 503})
+	if err := m.Reenter(context.Background()); err == nil {
+		t.Error("Expected acquire error")
+	}
+
+	// Release errors are returned by UnlockContext
+	if err := m.Reenter(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	locks.FailRelease(errors.New("unavailable"))
+	if err := m.UnlockContext(context.Background()); err == nil {
+		t.Error("Expected release error")
+	}
+	if err := m.UnlockContext(context.Background()); err == nil {
+		t.Error("Expected release error")
+	}
+	if m.Lost() != nil {
+		t.Error("Expected unlocked")
+	}
+}
+
+func TestDistributedMutexUnlockUnlocked(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic")
+		}
+	}()
+	lbclient.NewDistributedMutex(lbclienttest.NewLocks(), "d", "r").Unlock()
+}
@@ -2,6 +2,7 @@ package lbclient
 
 import (
 	"encoding/json"
+	"fmt"
 )
 
 // Projection is an opaque structure containing zero or more
@@ -212,8 +213,106 @@ func (p MatchProjection) GetProjection() map[string]interface{} {
 	if p.s != nil {
 		ret["sort"] = p.s
 	}
-	if p.p == nil {
+	if p.p != nil {
 		ret["projection"] = p.p
 	}
 	return ret
 }
+
+// UnmarshalJSON decodes a single projection, or an array of
+// projections. Projections with a range are decoded as
+// RangeProjection, projections with a match as MatchProjection, and
+// others as FieldProjection
+func (p *Projection) UnmarshalJSON(data []byte) error {
+	arr, err := jsonArray(data)
+	if err != nil {
+		return err
+	}
+	parts := make([]projectionPart, len(arr))
+	for i, x := range arr {
+		if parts[i], err = parseProjectionPart(x); err != nil {
+			return fmt.Errorf("projection[%d]: %s", i, err)
+		}
+	}
+	p.p = parts
+	return nil
+}
+
+func parseProjectionPart(data []byte) (projectionPart, error) {
+	m, err := jsonObject(data)
+	if err != nil {
+		return nil, err
+	}
+	_, isRange := m["range"]
+	_, isMatch := m["match"]
+	if isRange && isMatch {
+		return nil, fmt.Errorf("Both range and match are given")
+	}
+	if !isRange && !isMatch {
+		if m, err = jsonObject(data, "field", "include", "recursive"); err != nil {
+			return nil, err
+		}
+		field, err := jsonString(m, "field")
+		if err != nil {
+			return nil, err
+		}
+		include, err := jsonBool(m, "include", true)
+		if err != nil {
+			return nil, err
+		}
+		recursive, err := jsonBool(m, "recursive", false)
+		if err != nil {
+			return nil, err
+		}
+		return ProjectField(field, include, recursive), nil
+	}
+	var arr ArrayProjection
+	if isRange {
+		m, err = jsonObject(data, "field", "include", "range", "projection", "sort")
+	} else {
+		m, err = jsonObject(data, "field", "include", "match", "projection", "sort")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if arr.field, err = jsonString(m, "field"); err != nil {
+		return nil, err
+	}
+	if arr.include, err = jsonBool(m, "include", true); err != nil {
+		return nil, err
+	}
+	if raw, ok := m["projection"]; ok {
+		arr.p = &Projection{}
+		if err := arr.p.UnmarshalJSON(raw); err != nil {
+			return nil, err
+		}
+	}
+	if raw, ok := m["sort"]; ok {
+		arr.s = &Sort{}
+		if err := arr.s.UnmarshalJSON(raw); err != nil {
+			return nil, err
+		}
+	}
+	if isRange {
+		var bounds []json.RawMessage
+		if err := json.Unmarshal(m["range"], &bounds); err != nil || len(bounds) != 2 {
+			return nil, fmt.Errorf("Invalid range: %s", string(m["range"]))
+		}
+		var rng [2]int
+		for i, b := range bounds {
+			// null would be decoded as 0 instead of failing
+			if string(b) == "null" {
+				return nil, fmt.Errorf("Invalid range: %s: bound %d is null", string(m["range"]), i)
+			}
+			if err := json.Unmarshal(b, &rng[i]); err != nil {
+				return nil, fmt.Errorf("Invalid range: %s: bound %d is not an integer", string(m["range"]), i)
+			}
+		}
+		return RangeProjection{ArrayProjection: arr, rng: rng}, nil
+	}
+	var q Query
+	if err := q.UnmarshalJSON(m["match"]); err != nil {
+		return nil, fmt.Errorf("match: %s", err)
+	}
+	return MatchProjection{ArrayProjection: arr, q: q}, nil
+}
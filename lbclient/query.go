@@ -2,6 +2,9 @@ package lbclient
 
 import (
 	"encoding/json"
+	"fmt"
+
+	"github.com/lightblue-platform/go-client/lbclient/internal/eval"
 )
 
 // RegexOptions is a structure used to construct regular expression search predicates using additional options.
@@ -66,6 +69,16 @@ func CmpValue(field string, op RelationalOp, rvalue Literal) *Query {
 	return &ret
 }
 
+// CmpValueOf returns CmpValue(field, op, LitOf(rvalue)). It returns an
+// error if rvalue cannot be converted to a literal
+func CmpValueOf(field string, op RelationalOp, rvalue interface{}) (*Query, error) {
+	l, err := LitOf(rvalue)
+	if err != nil {
+		return nil, err
+	}
+	return CmpValue(field, op, l), nil
+}
+
 // CmpValueList returns a query of the form
 //
 //    { field: <field>, op:<op>, values:[<values>] }
@@ -88,6 +101,17 @@ func CmpValues(field string, op NaryOp, values ...Literal) *Query {
 	return &ret
 }
 
+// CmpValuesOf returns CmpValues(field, op, LitsOf(values)...), where
+// values is a slice or array of Go values. It returns an error if
+// values cannot be converted to literals
+func CmpValuesOf(field string, op NaryOp, values interface{}) (*Query, error) {
+	l, err := LitsOf(values)
+	if err != nil {
+		return nil, err
+	}
+	return CmpValues(field, op, l...), nil
+}
+
 // CmpField returns a query of the form
 //
 //    { field: <field>, op:<op>, rfield:<rfield> }
@@ -233,3 +257,231 @@ func (q *Query) String() string {
 func (q Query) MarshalJSON() ([]byte, error) {
 	return json.Marshal(q.q)
 }
+
+// Matches evaluates the query against doc using lightblue query
+// semantics. The document is converted to its JSON representation
+// first, so structs, typed slices and time.Time values are compared
+// the way the server sees them. Dates are compared chronologically.
+//
+// Field paths may contain * to match all array elements, in which
+// case the query matches if any of the matching values satisfy
+// it. Fields of an ArrayMatch query are relative to the array
+// element, and $parent refers to the enclosing node. A nil or empty
+// query matches all documents
+func (q *Query) Matches(doc map[string]interface{}) (bool, error) {
+	if q == nil || q.Empty() {
+		return true, nil
+	}
+	query, err := jsonTree(q)
+	if err != nil {
+		return false, err
+	}
+	tree, err := jsonTree(doc)
+	if err != nil {
+		return false, err
+	}
+	return eval.Matches(query, tree)
+}
+
+var relationalOps = map[string]RelationalOp{"=": EQ, "$eq": EQ, "!=": NEQ, "$neq": NEQ,
+	"<": LT, "$lt": LT, "<=": LTE, "$lte": LTE, ">": GT, "$gt": GT, ">=": GTE, "$gte": GTE}
+
+var naryOps = map[string]NaryOp{"$in": IN, "$nin": NIN, "$not_in": NIN}
+
+var arrayOps = map[string]ArrayOp{"$any": ANY, "$all": ALL, "$none": NONE}
+
+// UnmarshalJSON decodes a query expression, and builds the same
+// query the query constructors build
+func (q *Query) UnmarshalJSON(data []byte) error {
+	ret, err := parseQuery(data)
+	if err != nil {
+		return err
+	}
+	*q = *ret
+	return nil
+}
+
+func parseQuery(data []byte) (*Query, error) {
+	m, err := jsonObject(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"$and", "$or"} {
+		if raw, ok := m[op]; ok {
+			if len(m) != 1 {
+				return nil, fmt.Errorf("%s: unexpected fields", op)
+			}
+			var list []json.RawMessage
+			if err := json.Unmarshal(raw, &list); err != nil {
+				return nil, fmt.Errorf("%s: expected array", op)
+			}
+			queries := make([]*Query, len(list))
+			for i, x := range list {
+				if queries[i], err = parseQuery(x); err != nil {
+					return nil, fmt.Errorf("%s[%d]: %s", op, i, err)
+				}
+			}
+			if op == "$and" {
+				return AndList(queries), nil
+			}
+			return OrList(queries), nil
+		}
+	}
+	if raw, ok := m["$not"]; ok {
+		if len(m) != 1 {
+			return nil, fmt.Errorf("$not: unexpected fields")
+		}
+		nq, err := parseQuery(raw)
+		if err != nil {
+			return nil, fmt.Errorf("$not: %s", err)
+		}
+		return Not(nq), nil
+	}
+	if _, ok := m["array"]; ok {
+		return parseArrayQuery(data, m)
+	}
+	if _, ok := m["regex"]; ok {
+		return parseRegexQuery(data)
+	}
+	return parseComparison(data, m)
+}
+
+func parseArrayQuery(data []byte, m map[string]json.RawMessage) (*Query, error) {
+	if _, ok := m["elemMatch"]; ok {
+		m, err := jsonObject(data, "array", "elemMatch")
+		if err != nil {
+			return nil, err
+		}
+		array, err := jsonString(m, "array")
+		if err != nil {
+			return nil, err
+		}
+		em, err := parseQuery(m["elemMatch"])
+		if err != nil {
+			return nil, fmt.Errorf("elemMatch: %s", err)
+		}
+		return ArrayMatch(array, em), nil
+	}
+	m, err := jsonObject(data, "array", "contains", "values")
+	if err != nil {
+		return nil, err
+	}
+	array, err := jsonString(m, "array")
+	if err != nil {
+		return nil, err
+	}
+	c, err := jsonString(m, "contains")
+	if err != nil {
+		return nil, err
+	}
+	op, ok := arrayOps[c]
+	if !ok {
+		return nil, fmt.Errorf("contains: invalid array operator %s", c)
+	}
+	values, err := parseValues(m)
+	if err != nil {
+		return nil, err
+	}
+	return ArrayContainsList(array, op, values), nil
+}
+
+func parseRegexQuery(data []byte) (*Query, error) {
+	m, err := jsonObject(data, "field", "regex", "caseInsensitive", "extended", "multiline", "dotall")
+	if err != nil {
+		return nil, err
+	}
+	field, err := jsonString(m, "field")
+	if err != nil {
+		return nil, err
+	}
+	pattern, err := jsonString(m, "regex")
+	if err != nil {
+		return nil, err
+	}
+	var options RegexOptions
+	for name, opt := range map[string]*bool{"caseInsensitive": &options.CaseInsensitive,
+		"extended": &options.Extended, "multiline": &options.Multiline, "dotall": &options.Dotall} {
+		if *opt, err = jsonBool(m, name, false); err != nil {
+			return nil, err
+		}
+	}
+	return CmpRegex(field, pattern, options), nil
+}
+
+func parseValues(m map[string]json.RawMessage) ([]Literal, error) {
+	raw, ok := m["values"]
+	if !ok {
+		return nil, fmt.Errorf("Missing values")
+	}
+	var values []Literal
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, fmt.Errorf("values: %s", err)
+	}
+	if values == nil {
+		return nil, fmt.Errorf("values: expected array")
+	}
+	return values, nil
+}
+
+func parseComparison(data []byte, m map[string]json.RawMessage) (*Query, error) {
+	if _, ok := m["field"]; !ok {
+		return nil, fmt.Errorf("Unrecognized query expression: %s", string(data))
+	}
+	var rhs string
+	for _, x := range []string{"rvalue", "values", "rfield"} {
+		if _, ok := m[x]; ok {
+			if len(rhs) > 0 {
+				return nil, fmt.Errorf("Both %s and %s are given", rhs, x)
+			}
+			rhs = x
+		}
+	}
+	if len(rhs) == 0 {
+		return nil, fmt.Errorf("Missing rvalue, values, or rfield")
+	}
+	m, err := jsonObject(data, "field", "op", rhs)
+	if err != nil {
+		return nil, err
+	}
+	field, err := jsonString(m, "field")
+	if err != nil {
+		return nil, err
+	}
+	op, err := jsonString(m, "op")
+	if err != nil {
+		return nil, err
+	}
+	relOp, isRel := relationalOps[op]
+	naryOp, isNary := naryOps[op]
+	switch rhs {
+	case "rvalue":
+		if !isRel {
+			return nil, fmt.Errorf("op: invalid relational operator %s", op)
+		}
+		var rvalue Literal
+		if err := json.Unmarshal(m["rvalue"], &rvalue); err != nil {
+			return nil, fmt.Errorf("rvalue: %s", err)
+		}
+		return CmpValue(field, relOp, rvalue), nil
+	case "values":
+		if !isNary {
+			return nil, fmt.Errorf("op: invalid n-ary operator %s", op)
+		}
+		values, err := parseValues(m)
+		if err != nil {
+			return nil, err
+		}
+		return CmpValueList(field, naryOp, values), nil
+	}
+	rfield, err := jsonString(m, "rfield")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case isRel:
+		return CmpField(field, relOp, rfield), nil
+	case isNary:
+		return CmpFieldValues(field, naryOp, rfield), nil
+	}
+	return nil, fmt.Errorf("op: invalid operator %s", op)
+}
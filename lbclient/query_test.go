@@ -185,3 +185,62 @@ func TestArrayMatch(t *testing.T) {
 		t.Errorf("%q", m)
 	}
 }
+
+func TestQueryMatches(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+		Zip  int    `json:"zip"`
+	}
+	doc := map[string]interface{}{
+		"name":    "John",
+		"nick":    "john",
+		"age":     int64(30),
+		"score":   1.5,
+		"tags":    []string{"a", "b"},
+		"allowed": []int{30, 40},
+		"created": time.Date(2017, time.January, 15, 13, 11, 15, 0, time.UTC),
+		"addr":    []address{{"x", 1}, {"y", 2}},
+		"limit":   2,
+	}
+	tests := []struct {
+		q        *Query
+		expected bool
+	}{
+		{CmpValue("name", EQ, LitStr("John")), true},
+		{CmpValue("age", GTE, LitInt(30)), true},
+		{CmpValue("score", LT, LitDouble(1.5)), false},
+		{CmpValue("missing", EQ, LitNull()), true},
+		{CmpValue("created", GT, LitDate(time.Date(2017, time.January, 1, 0, 0, 0, 0, time.FixedZone("", 3600)))), true},
+		{CmpValue("created", EQ, LitDate(time.Date(2017, time.January, 15, 14, 11, 15, 0, time.FixedZone("", 3600)))), true},
+		{CmpField("name", NEQ, "nick"), true},
+		{CmpValues("age", IN, LitInts(1, 30)...), true},
+		{CmpValues("age", NIN, LitInts(1, 30)...), false},
+		{CmpFieldValues("age", IN, "allowed"), true},
+		{CmpFieldValues("age", NIN, "allowed"), false},
+		{CmpRegex("name", "^j", RegexOptions{}), false},
+		{CmpRegex("name", "^j o", RegexOptions{CaseInsensitive: true, Extended: true}), true},
+		{ArrayContains("tags", ANY, LitStrs("b", "z")...), true},
+		{ArrayContains("tags", ALL, LitStrs("b", "z")...), false},
+		{ArrayContains("tags", NONE, LitStrs("z")...), true},
+		{ArrayMatch("addr", And(CmpValue("city", EQ, LitStr("y")), CmpValue("zip", EQ, LitInt(2)))), true},
+		{ArrayMatch("addr", And(CmpValue("city", EQ, LitStr("y")), CmpValue("zip", EQ, LitInt(1)))), false},
+		{ArrayMatch("addr", CmpField("zip", EQ, "$parent.$parent.limit")), true},
+		{CmpValue("addr.*.city", EQ, LitStr("y")), true},
+		{CmpValue("addr.0.city", EQ, LitStr("y")), false},
+		{Or(CmpValue("age", EQ, LitInt(1)), CmpValue("name", EQ, LitStr("John"))), true},
+		{Not(CmpValue("age", EQ, LitInt(30))), false},
+		{&Query{}, true},
+		{nil, true},
+	}
+	for _, test := range tests {
+		r, err := test.q.Matches(doc)
+		if err != nil {
+			t.Errorf("%s: %s", test.q, err)
+		} else if r != test.expected {
+			t.Errorf("%s: expected %t", test.q, test.expected)
+		}
+	}
+	if _, err := CmpRegex("name", "(", RegexOptions{}).Matches(doc); err == nil {
+		t.Errorf("Expected error for invalid regex")
+	}
+}
@@ -0,0 +1,450 @@
+package lbclient
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QueryNode is a node of the query syntax tree. Use Query.AST to get
+// the syntax tree of a query, and QueryNode.ToQuery to build a query
+// from a syntax tree. The node types are ValueComparison,
+// FieldComparison, ValueListComparison, FieldListComparison,
+// RegexComparison, ArrayContainsExpr, ArrayMatchExpr, AndExpr, OrExpr
+// and NotExpr
+type QueryNode interface {
+	// ToQuery builds the query for the node using the query constructors
+	ToQuery() *Query
+	queryNode()
+}
+
+// ValueComparison is a { field: <field>, op:<op>, rvalue:<rvalue> } node
+type ValueComparison struct {
+	Field string
+	Op    RelationalOp
+	Value Literal
+}
+
+// FieldComparison is a { field: <field>, op:<op>, rfield:<rfield> } node
+type FieldComparison struct {
+	Field  string
+	Op     RelationalOp
+	RField string
+}
+
+// ValueListComparison is a { field: <field>, op:<op>, values:[<values>] } node
+type ValueListComparison struct {
+	Field  string
+	Op     NaryOp
+	Values []Literal
+}
+
+// FieldListComparison is a { field: <field>, op:<op>, rfield:<rfield> }
+// node where op is IN or NIN
+type FieldListComparison struct {
+	Field  string
+	Op     NaryOp
+	RField string
+}
+
+// RegexComparison is a { field: <field>, regex: <pattern>, ... } node
+type RegexComparison struct {
+	Field   string
+	Pattern string
+	Options RegexOptions
+}
+
+// ArrayContainsExpr is a { array:<array>, contains: <op>, values:[<values>] } node
+type ArrayContainsExpr struct {
+	Array  string
+	Op     ArrayOp
+	Values []Literal
+}
+
+// ArrayMatchExpr is a { array:<array>, elemMatch: <query> } node. The
+// fields of the query are relative to the array elements
+type ArrayMatchExpr struct {
+	Array string
+	Query QueryNode
+}
+
+// AndExpr is a { $and: [ <query> ] } node
+type AndExpr struct {
+	Queries []QueryNode
+}
+
+// OrExpr is a { $or: [ <query> ] } node
+type OrExpr struct {
+	Queries []QueryNode
+}
+
+// NotExpr is a { $not: <query> } node
+type NotExpr struct {
+	Query QueryNode
+}
+
+func (ValueComparison) queryNode()     {}
+func (FieldComparison) queryNode()     {}
+func (ValueListComparison) queryNode() {}
+func (FieldListComparison) queryNode() {}
+func (RegexComparison) queryNode()     {}
+func (ArrayContainsExpr) queryNode()   {}
+func (ArrayMatchExpr) queryNode()      {}
+func (AndExpr) queryNode()             {}
+func (OrExpr) queryNode()              {}
+func (NotExpr) queryNode()             {}
+
+// ToQuery returns CmpValue(Field, Op, Value)
+func (n ValueComparison) ToQuery() *Query {
+	return CmpValue(n.Field, n.Op, n.Value)
+}
+
+// ToQuery returns CmpField(Field, Op, RField)
+func (n FieldComparison) ToQuery() *Query {
+	return CmpField(n.Field, n.Op, n.RField)
+}
+
+// ToQuery returns CmpValueList(Field, Op, Values)
+func (n ValueListComparison) ToQuery() *Query {
+	return CmpValueList(n.Field, n.Op, n.Values)
+}
+
+// ToQuery returns CmpFieldValues(Field, Op, RField)
+func (n FieldListComparison) ToQuery() *Query {
+	return CmpFieldValues(n.Field, n.Op, n.RField)
+}
+
+// ToQuery returns CmpRegex(Field, Pattern, Options)
+func (n RegexComparison) ToQuery() *Query {
+	return CmpRegex(n.Field, n.Pattern, n.Options)
+}
+
+// ToQuery returns ArrayContainsList(Array, Op, Values)
+func (n ArrayContainsExpr) ToQuery() *Query {
+	return ArrayContainsList(n.Array, n.Op, n.Values)
+}
+
+// ToQuery returns ArrayMatch(Array, Query)
+func (n ArrayMatchExpr) ToQuery() *Query {
+	return ArrayMatch(n.Array, n.Query.ToQuery())
+}
+
+// ToQuery returns AndList(Queries)
+func (n AndExpr) ToQuery() *Query {
+	return AndList(toQueries(n.Queries))
+}
+
+// ToQuery returns OrList(Queries)
+func (n OrExpr) ToQuery() *Query {
+	return OrList(toQueries(n.Queries))
+}
+
+// ToQuery returns Not(Query)
+func (n NotExpr) ToQuery() *Query {
+	return Not(n.Query.ToQuery())
+}
+
+func toQueries(nodes []QueryNode) []*Query {
+	ret := make([]*Query, len(nodes))
+	for i, n := range nodes {
+		ret[i] = n.ToQuery()
+	}
+	return ret
+}
+
+// AST returns the syntax tree of the query. An empty query returns
+// nil
+func (q *Query) AST() (QueryNode, error) {
+	if q == nil || q.Empty() {
+		return nil, nil
+	}
+	return queryAST(q.q)
+}
+
+func queryAST(q map[string]interface{}) (QueryNode, error) {
+	if list, ok := q["$and"]; ok {
+		nodes, err := listAST(list)
+		if err != nil {
+			return nil, fmt.Errorf("$and: %s", err)
+		}
+		return AndExpr{Queries: nodes}, nil
+	}
+	if list, ok := q["$or"]; ok {
+		nodes, err := listAST(list)
+		if err != nil {
+			return nil, fmt.Errorf("$or: %s", err)
+		}
+		return OrExpr{Queries: nodes}, nil
+	}
+	if x, ok := q["$not"]; ok {
+		n, err := nestedAST(x)
+		if err != nil {
+			return nil, fmt.Errorf("$not: %s", err)
+		}
+		return NotExpr{Query: n}, nil
+	}
+	if array, ok := q["array"].(string); ok {
+		if x, ok := q["elemMatch"]; ok {
+			n, err := nestedAST(x)
+			if err != nil {
+				return nil, fmt.Errorf("elemMatch: %s", err)
+			}
+			return ArrayMatchExpr{Array: array, Query: n}, nil
+		}
+		op, ok1 := q["contains"].(ArrayOp)
+		values, ok2 := q["values"].([]Literal)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("Invalid array query: %v", q)
+		}
+		return ArrayContainsExpr{Array: array, Op: op, Values: values}, nil
+	}
+	field, ok := q["field"].(string)
+	if !ok {
+		return nil, fmt.Errorf("Invalid query: %v", q)
+	}
+	if pattern, ok := q["regex"].(string); ok {
+		n := RegexComparison{Field: field, Pattern: pattern}
+		n.Options.CaseInsensitive, _ = q["caseInsensitive"].(bool)
+		n.Options.Extended, _ = q["extended"].(bool)
+		n.Options.Multiline, _ = q["multiline"].(bool)
+		n.Options.Dotall, _ = q["dotall"].(bool)
+		return n, nil
+	}
+	rfield, isField := q["rfield"].(string)
+	switch op := q["op"].(type) {
+	case RelationalOp:
+		if isField {
+			return FieldComparison{Field: field, Op: op, RField: rfield}, nil
+		}
+		if value, ok := q["rvalue"].(Literal); ok {
+			return ValueComparison{Field: field, Op: op, Value: value}, nil
+		}
+	case NaryOp:
+		if isField {
+			return FieldListComparison{Field: field, Op: op, RField: rfield}, nil
+		}
+		if values, ok := q["values"].([]Literal); ok {
+			return ValueListComparison{Field: field, Op: op, Values: values}, nil
+		}
+	}
+	return nil, fmt.Errorf("Invalid comparison: %v", q)
+}
+
+func nestedAST(x interface{}) (QueryNode, error) {
+	q, ok := x.(Query)
+	if !ok || q.Empty() {
+		return nil, fmt.Errorf("Invalid query: %v", x)
+	}
+	return queryAST(q.q)
+}
+
+func listAST(x interface{}) ([]QueryNode, error) {
+	list, ok := x.([]Query)
+	if !ok {
+		return nil, fmt.Errorf("Invalid query list: %v", x)
+	}
+	nodes := make([]QueryNode, len(list))
+	for i, q := range list {
+		n, err := nestedAST(q)
+		if err != nil {
+			return nil, fmt.Errorf("[%d]: %s", i, err)
+		}
+		nodes[i] = n
+	}
+	return nodes, nil
+}
+
+// Walk traverses the syntax tree rooted at node in depth-first
+// order. It calls visit for each node, and descends into the children
+// of the node only if visit returns true
+func Walk(node QueryNode, visit func(QueryNode) bool) {
+	if node == nil || !visit(node) {
+		return
+	}
+	for _, child := range children(node) {
+		Walk(child, visit)
+	}
+}
+
+func children(node QueryNode) []QueryNode {
+	switch n := node.(type) {
+	case AndExpr:
+		return n.Queries
+	case OrExpr:
+		return n.Queries
+	case NotExpr:
+		return []QueryNode{n.Query}
+	case ArrayMatchExpr:
+		return []QueryNode{n.Query}
+	}
+	return nil
+}
+
+// Rewrite returns a copy of the syntax tree rooted at node, where
+// every node is replaced by the return value of fn. Children are
+// rewritten before their parents, so fn sees the rewritten
+// children. If fn returns nil, the node is removed: it is dropped from
+// $and and $or lists, and removing the only child of $not, elemMatch,
+// or all elements of $and and $or lists removes the parent
+// as well. The input tree is not modified
+func Rewrite(node QueryNode, fn func(QueryNode) QueryNode) QueryNode {
+	if node == nil {
+		return nil
+	}
+	switch n := node.(type) {
+	case AndExpr:
+		list := rewriteList(n.Queries, fn)
+		if len(list) == 0 {
+			return nil
+		}
+		node = AndExpr{Queries: list}
+	case OrExpr:
+		list := rewriteList(n.Queries, fn)
+		if len(list) == 0 {
+			return nil
+		}
+		node = OrExpr{Queries: list}
+	case NotExpr:
+		q := Rewrite(n.Query, fn)
+		if q == nil {
+			return nil
+		}
+		node = NotExpr{Query: q}
+	case ArrayMatchExpr:
+		q := Rewrite(n.Query, fn)
+		if q == nil {
+			return nil
+		}
+		node = ArrayMatchExpr{Array: n.Array, Query: q}
+	case ValueListComparison:
+		n.Values = append([]Literal(nil), n.Values...)
+		node = n
+	case ArrayContainsExpr:
+		n.Values = append([]Literal(nil), n.Values...)
+		node = n
+	}
+	return fn(node)
+}
+
+func rewriteList(nodes []QueryNode, fn func(QueryNode) QueryNode) []QueryNode {
+	ret := make([]QueryNode, 0, len(nodes))
+	for _, n := range nodes {
+		if r := Rewrite(n, fn); r != nil {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+// RewriteQuery rewrites the query using Rewrite, and returns the
+// resulting query. If all nodes are removed, it returns an empty
+// query
+func RewriteQuery(q *Query, fn func(QueryNode) QueryNode) (*Query, error) {
+	node, err := q.AST()
+	if err != nil {
+		return nil, err
+	}
+	if node = Rewrite(node, fn); node == nil {
+		return &Query{}, nil
+	}
+	return node.ToQuery(), nil
+}
+
+// RenameFields returns a copy of the query where every field
+// reference is replaced by the return value of rename. Fields of
+// elemMatch queries are passed as they are written, relative to the
+// array element
+func RenameFields(q *Query, rename func(string) string) (*Query, error) {
+	return RewriteQuery(q, func(node QueryNode) QueryNode {
+		switch n := node.(type) {
+		case ValueComparison:
+			n.Field = rename(n.Field)
+			return n
+		case FieldComparison:
+			n.Field, n.RField = rename(n.Field), rename(n.RField)
+			return n
+		case ValueListComparison:
+			n.Field = rename(n.Field)
+			return n
+		case FieldListComparison:
+			n.Field, n.RField = rename(n.Field), rename(n.RField)
+			return n
+		case RegexComparison:
+			n.Field = rename(n.Field)
+			return n
+		case ArrayContainsExpr:
+			n.Array = rename(n.Array)
+			return n
+		case ArrayMatchExpr:
+			n.Array = rename(n.Array)
+			return n
+		}
+		return node
+	})
+}
+
+// Fields returns the field paths referenced by the query, in the
+// order they first appear. Fields of elemMatch queries are returned
+// as absolute paths of the form array.*.field, with $parent and $this
+// references resolved
+func (q *Query) Fields() []string {
+	node, err := q.AST()
+	if err != nil {
+		return nil
+	}
+	var ret []string
+	seen := make(map[string]bool)
+	addField := func(prefix []string, field string) {
+		f := absoluteField(prefix, field)
+		if !seen[f] {
+			seen[f] = true
+			ret = append(ret, f)
+		}
+	}
+	var collect func(prefix []string, node QueryNode)
+	collect = func(prefix []string, node QueryNode) {
+		Walk(node, func(node QueryNode) bool {
+			switch n := node.(type) {
+			case ValueComparison:
+				addField(prefix, n.Field)
+			case FieldComparison:
+				addField(prefix, n.Field)
+				addField(prefix, n.RField)
+			case ValueListComparison:
+				addField(prefix, n.Field)
+			case FieldListComparison:
+				addField(prefix, n.Field)
+				addField(prefix, n.RField)
+			case RegexComparison:
+				addField(prefix, n.Field)
+			case ArrayContainsExpr:
+				addField(prefix, n.Array)
+			case ArrayMatchExpr:
+				addField(prefix, n.Array)
+				elem := append(strings.Split(absoluteField(prefix, n.Array), "."), "*")
+				collect(elem, n.Query)
+				return false
+			}
+			return true
+		})
+	}
+	collect(nil, node)
+	return ret
+}
+
+// absoluteField appends field to the prefix path, and resolves
+// $parent and $this references
+func absoluteField(prefix []string, field string) string {
+	path := append([]string(nil), prefix...)
+	for _, seg := range strings.Split(field, ".") {
+		switch seg {
+		case "$this":
+		case "$parent":
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		default:
+			path = append(path, seg)
+		}
+	}
+	return strings.Join(path, ".")
+}
@@ -0,0 +1,95 @@
+package lbclient
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQueryASTRoundTrip(t *testing.T) {
+	q := MustParseQuery("a = 1 and (b = c or d in [1, 2] or e not in f) and not g =~ /x/i and arr any ['x'] and arr elemMatch (x = 1)")
+	node, err := q.AST()
+	if err != nil {
+		t.Fatal(err)
+	}
+	and, ok := node.(AndExpr)
+	if !ok || len(and.Queries) != 5 {
+		t.Fatalf("Unexpected tree: %#v", node)
+	}
+	if _, ok := and.Queries[3].(ArrayContainsExpr); !ok {
+		t.Errorf("Expected ArrayContainsExpr, got %T", and.Queries[3])
+	}
+	expected, _ := json.Marshal(q)
+	actual, _ := json.Marshal(node.ToQuery())
+	if string(expected) != string(actual) {
+		t.Errorf("Expected %s, got %s", string(expected), string(actual))
+	}
+	if n, err := (&Query{}).AST(); n != nil || err != nil {
+		t.Errorf("Expected nil tree for empty query")
+	}
+}
+
+func TestWalk(t *testing.T) {
+	node, _ := MustParseQuery("a = 1 and not b = 2 and arr elemMatch (c = 1)").AST()
+	var kinds []string
+	Walk(node, func(n QueryNode) bool {
+		kinds = append(kinds, reflect.TypeOf(n).Name())
+		_, isMatch := n.(ArrayMatchExpr)
+		return !isMatch
+	})
+	expected := []string{"AndExpr", "ValueComparison", "NotExpr", "ValueComparison", "ArrayMatchExpr"}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("Expected %v, got %v", expected, kinds)
+	}
+}
+
+func TestRewriteQuery(t *testing.T) {
+	q := MustParseQuery("tenant = 'a' and (x = 1 or tenant = 'b')")
+	// Remove all tenant filters, and inject a new one
+	r, err := RewriteQuery(q, func(n QueryNode) QueryNode {
+		if c, ok := n.(ValueComparison); ok && c.Field == "tenant" {
+			return nil
+		}
+		return n
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := FormatQuery(And(r, CmpValue("tenant", EQ, LitStr("t1"))))
+	if s != "x = 1 and tenant = 't1'" {
+		t.Errorf("Wrong query: %s", s)
+	}
+	// Original query is not modified
+	if s, _ := FormatQuery(q); s != "tenant = 'a' and (x = 1 or tenant = 'b')" {
+		t.Errorf("Original query modified: %s", s)
+	}
+	r, _ = RewriteQuery(q, func(QueryNode) QueryNode { return nil })
+	if !r.Empty() {
+		t.Errorf("Expected empty query, got %s", r)
+	}
+}
+
+func TestRenameFields(t *testing.T) {
+	q := MustParseQuery("old.a = old.b and old.arr elemMatch (old = 1)")
+	r, err := RenameFields(q, func(f string) string {
+		if strings.HasPrefix(f, "old.") {
+			return "new." + strings.TrimPrefix(f, "old.")
+		}
+		return f
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := FormatQuery(r); s != "new.a = new.b and new.arr elemMatch (old = 1)" {
+		t.Errorf("Wrong query: %s", s)
+	}
+}
+
+func TestQueryFields(t *testing.T) {
+	q := MustParseQuery("a = b and c in d and a > 1 and e =~ /x/ and tags any [1] and arr elemMatch (x = 1 and y = $parent.$parent.z and sub elemMatch (w = $this.v))")
+	expected := []string{"a", "b", "c", "d", "e", "tags", "arr", "arr.*.x", "arr.*.y", "z", "arr.*.sub", "arr.*.sub.*.w", "arr.*.sub.*.v"}
+	if f := q.Fields(); !reflect.DeepEqual(f, expected) {
+		t.Errorf("Expected %v, got %v", expected, f)
+	}
+}
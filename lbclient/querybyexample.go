@@ -0,0 +1,305 @@
+package lbclient
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrEmptyExample is returned by QueryByExample if the example has no
+// fields to match, and MatchAll is not set
+var ErrEmptyExample = errors.New("example has no fields to match")
+
+// ExampleOptions controls how QueryByExample builds a query
+type ExampleOptions struct {
+	// IncludeZero=true includes fields with zero values in the query,
+	// unless they are tagged omitempty. By default zero values are
+	// ignored. Non-nil pointers are always included
+	IncludeZero bool
+	// CaseInsensitive=true compares string fields case insensitively
+	// using CmpRegex. Array elements are always compared exactly
+	CaseInsensitive bool
+	// Prefix is prepended to all field names, so an example can be
+	// matched against a nested document. For example, with
+	// Prefix="address", the field city becomes address.city
+	Prefix string
+	// MatchAll=true returns an empty query, matching all documents,
+	// for an example without any fields to match. By default
+	// ErrEmptyExample is returned
+	MatchAll bool
+}
+
+// QueryByExample builds a query from a populated struct or map. The
+// query is the conjunction of:
+//
+//   - CmpValue(field, EQ, value) for scalar fields,
+//   - CmpRegex(field, ^value$) for strings, if CaseInsensitive is set,
+//   - ArrayContains(field, ALL, values) for slices of scalars,
+//   - ArrayMatch(field, example) for each struct or map element of a slice,
+//   - nested fields of structs and maps, as field.nested.
+//
+// Field names are taken from json tags, embedded structs are flattened
+// the way encoding/json does, map keys are used in sorted order, and
+// unexported fields are ignored. Dates, json.Marshaler and
+// encoding.TextMarshaler values are compared as scalars using
+// LitOf. With IncludeZero, an empty slice is matched using the array
+// size field, field#. An example without any fields to match, such
+// as a nil pointer or a zero struct, returns ErrEmptyExample unless
+// MatchAll is set
+func QueryByExample(v interface{}, opts ExampleOptions) (*Query, error) {
+	b := exampleBuilder{opts: opts}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return b.query()
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct && rv.Kind() != reflect.Map {
+		return nil, fmt.Errorf("Expected struct or map, got %T", v)
+	}
+	if err := b.object(opts.Prefix, rv); err != nil {
+		return nil, err
+	}
+	return b.query()
+}
+
+type exampleBuilder struct {
+	opts  ExampleOptions
+	terms []*Query
+}
+
+// query returns the conjunction of the terms
+func (b *exampleBuilder) query() (*Query, error) {
+	switch len(b.terms) {
+	case 0:
+		if !b.opts.MatchAll {
+			return nil, ErrEmptyExample
+		}
+		return &Query{}, nil
+	case 1:
+		return b.terms[0], nil
+	}
+	return AndList(b.terms), nil
+}
+
+func joinField(prefix, field string) string {
+	if len(prefix) == 0 {
+		return field
+	}
+	return prefix + "." + field
+}
+
+// object adds the fields of a struct or map
+func (b *exampleBuilder) object(prefix string, rv reflect.Value) error {
+	if rv.Kind() == reflect.Map {
+		if rv.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("%s: map keys must be strings", prefix)
+		}
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			if err := b.value(joinField(prefix, k.String()), rv.MapIndex(k), false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, omitEmpty, skip := jsonField(sf)
+		if skip {
+			continue
+		}
+		fv := rv.Field(i)
+		if !sf.IsExported() {
+			// Embedded unexported struct, its exported fields are encoded
+			if err := b.object(prefix, fv); err != nil {
+				return err
+			}
+			continue
+		}
+		if sf.Anonymous && len(name) == 0 {
+			// Flatten embedded structs without a json name
+			ev := fv
+			for ev.Kind() == reflect.Ptr && !ev.IsNil() {
+				ev = ev.Elem()
+			}
+			if ev.Kind() == reflect.Ptr {
+				continue
+			}
+			if ev.Kind() == reflect.Struct && !isExampleScalar(ev) {
+				if err := b.object(prefix, ev); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if len(name) == 0 {
+			name = sf.Name
+		}
+		if err := b.value(joinField(prefix, name), fv, omitEmpty); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonField returns the json name of a struct field, and whether it is
+// omitempty, or skip=true if the field is not encoded
+func jsonField(sf reflect.StructField) (name string, omitEmpty bool, skip bool) {
+	if !sf.IsExported() && !(sf.Anonymous && sf.Type.Kind() == reflect.Struct) {
+		return "", false, true
+	}
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return parts[0], omitEmpty, false
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+var exampleScalarTypes = map[reflect.Type]bool{
+	reflect.TypeOf(time.Time{}): true,
+	reflect.TypeOf(Date{}):      true,
+	reflect.TypeOf(NullDate{}):  true,
+	reflect.TypeOf(big.Int{}):   true,
+	reflect.TypeOf(big.Float{}): true,
+	reflect.TypeOf(Literal{}):   true,
+}
+
+// isExampleScalar returns if the value is compared as a whole, instead
+// of field by field
+func isExampleScalar(rv reflect.Value) bool {
+	return isScalarType(rv.Type())
+}
+
+// isScalarType returns if values of the type are encoded as a whole by
+// LitOf and encoding/json: dates, big numbers, literals, and types
+// with JSON or text marshalers
+func isScalarType(t reflect.Type) bool {
+	if exampleScalarTypes[t] {
+		return true
+	}
+	return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) ||
+		reflect.PointerTo(t).Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType)
+}
+
+// value adds the terms for a field value
+func (b *exampleBuilder) value(field string, rv reflect.Value, omitEmpty bool) error {
+	explicit := false
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			if b.opts.IncludeZero && !omitEmpty {
+				b.terms = append(b.terms, CmpValue(field, EQ, LitNull()))
+			}
+			return nil
+		}
+		explicit = explicit || rv.Kind() == reflect.Ptr
+		rv = rv.Elem()
+	}
+	compound := isExampleCompound(rv)
+	// A pointer to a scalar is included even if it points to a zero value
+	if isEmptyValue(rv) && !(explicit && !compound) && (!b.opts.IncludeZero || omitEmpty) {
+		return nil
+	}
+	if !compound {
+		return b.scalar(field, rv)
+	}
+	switch rv.Kind() {
+	case reflect.Struct, reflect.Map:
+		return b.object(field, rv)
+	}
+	return b.array(field, rv)
+}
+
+// isExampleCompound returns if the value is a struct, map or array
+// that is matched element by element
+func isExampleCompound(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Struct, reflect.Map:
+		return !isExampleScalar(rv)
+	case reflect.Slice, reflect.Array:
+		return rv.Type().Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+// isEmptyValue returns if the value is zero, or an empty slice or map
+func isEmptyValue(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
+
+func (b *exampleBuilder) scalar(field string, rv reflect.Value) error {
+	if rv.Kind() == reflect.String && b.opts.CaseInsensitive {
+		b.terms = append(b.terms, CmpRegex(field, "^"+regexp.QuoteMeta(rv.String())+"$", RegexOptions{CaseInsensitive: true}))
+		return nil
+	}
+	l, err := LitOf(rv.Interface())
+	if err != nil {
+		return fmt.Errorf("%s: %s", field, err)
+	}
+	b.terms = append(b.terms, CmpValue(field, EQ, l))
+	return nil
+}
+
+// array adds the terms for a slice or array. Scalar elements are
+// matched with ArrayContains, and struct or map elements with an
+// ArrayMatch for each element
+func (b *exampleBuilder) array(field string, rv reflect.Value) error {
+	if rv.Len() == 0 {
+		b.terms = append(b.terms, CmpValue(field+"#", EQ, LitInt(0)))
+		return nil
+	}
+	var values []Literal
+	for i := 0; i < rv.Len(); i++ {
+		e := rv.Index(i)
+		for e.Kind() == reflect.Ptr || e.Kind() == reflect.Interface {
+			if e.IsNil() {
+				break
+			}
+			e = e.Elem()
+		}
+		if (e.Kind() == reflect.Struct || e.Kind() == reflect.Map) && !isExampleScalar(e) {
+			elem := exampleBuilder{opts: ExampleOptions{IncludeZero: b.opts.IncludeZero, CaseInsensitive: b.opts.CaseInsensitive}}
+			if err := elem.object("", e); err != nil {
+				return err
+			}
+			if q, err := elem.query(); err == nil {
+				b.terms = append(b.terms, ArrayMatch(field, q))
+			}
+			continue
+		}
+		l, err := LitOf(e.Interface())
+		if err != nil {
+			return fmt.Errorf("%s[%d]: %s", field, i, err)
+		}
+		values = append(values, l)
+	}
+	if len(values) > 0 {
+		b.terms = append(b.terms, ArrayContainsList(field, ALL, values))
+	}
+	return nil
+}
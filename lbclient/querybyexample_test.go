@@ -0,0 +1,109 @@
+package lbclient
+
+import (
+	"testing"
+	"time"
+)
+
+type exampleAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+type exampleBase struct {
+	ID string `json:"_id"`
+}
+
+type exampleDoc struct {
+	exampleBase
+	Name      string           `json:"name"`
+	Age       int              `json:"age"`
+	Active    *bool            `json:"active"`
+	Tags      []string         `json:"tags"`
+	Address   exampleAddress   `json:"address"`
+	Previous  []exampleAddress `json:"previous"`
+	Created   Date             `json:"created"`
+	Ignored   string           `json:"-"`
+	NoTag     int
+	unexposed string
+}
+
+type ExampleEmbedded struct {
+	Kind string `json:"kind"`
+}
+
+type exampleWithEmbedded struct {
+	ExampleEmbedded
+	Name string `json:"name"`
+}
+
+func TestQueryByExample(t *testing.T) {
+	inactive := false
+	date := time.Date(2017, time.January, 15, 13, 11, 15, 123000000, time.UTC)
+	tests := []struct {
+		v        interface{}
+		opts     ExampleOptions
+		expected string
+	}{
+		{exampleDoc{Name: "john", Age: 30}, ExampleOptions{}, "name = 'john' and age = 30"},
+		{&exampleDoc{Active: &inactive, Tags: []string{"a", "b"}, Ignored: "x", NoTag: 1, unexposed: "y"}, ExampleOptions{},
+			"active = false and tags all ['a', 'b'] and NoTag = 1"},
+		{exampleDoc{Address: exampleAddress{City: "x"}, Previous: []exampleAddress{{City: "y", Zip: "1"}}}, ExampleOptions{},
+			"address.city = 'x' and previous elemMatch (city = 'y' and zip = '1')"},
+		{exampleDoc{Created: DateOf(date)}, ExampleOptions{}, "created = '20170115T13:11:15.123+0000'"},
+		{exampleDoc{Name: "J.R."}, ExampleOptions{CaseInsensitive: true, Prefix: "person"}, "person.name =~ /^J\\.R\\.$/i"},
+		{exampleAddress{}, ExampleOptions{IncludeZero: true}, "city = ''"},
+		{struct {
+			Tags []string `json:"tags"`
+			P    *int     `json:"p"`
+		}{Tags: []string{}}, ExampleOptions{IncludeZero: true}, "tags# = 0 and p = null"},
+		{map[string]interface{}{"b": 1, "a": map[string]interface{}{"c": "x"}, "z": nil}, ExampleOptions{}, "a.c = 'x' and b = 1"},
+		{exampleWithEmbedded{ExampleEmbedded{Kind: "k"}, "n"}, ExampleOptions{}, "kind = 'k' and name = 'n'"},
+		{exampleDoc{exampleBase: exampleBase{ID: "1"}}, ExampleOptions{}, "_id = '1'"},
+		{exampleDoc{}, ExampleOptions{MatchAll: true}, ""},
+		{(*exampleDoc)(nil), ExampleOptions{MatchAll: true}, ""},
+	}
+	for _, test := range tests {
+		q, err := QueryByExample(test.v, test.opts)
+		if err != nil {
+			t.Errorf("%+v: %s", test.v, err)
+			continue
+		}
+		if len(test.expected) == 0 {
+			if !q.Empty() {
+				t.Errorf("%+v: expected empty query, got %s", test.v, q)
+			}
+			continue
+		}
+		s, err := FormatQuery(q)
+		if err != nil {
+			t.Errorf("%+v: %s", test.v, err)
+		} else if s != test.expected {
+			t.Errorf("%+v: expected %s, got %s", test.v, test.expected, s)
+		}
+	}
+	if _, err := QueryByExample(1, ExampleOptions{}); err == nil {
+		t.Errorf("Expected error for non-struct")
+	}
+	for _, v := range []interface{}{exampleDoc{}, (*exampleDoc)(nil), map[string]interface{}{"z": nil}} {
+		if _, err := QueryByExample(v, ExampleOptions{}); err != ErrEmptyExample {
+			t.Errorf("%+v: expected ErrEmptyExample, got %v", v, err)
+		}
+	}
+}
+
+func TestQueryByExampleMatches(t *testing.T) {
+	q, err := QueryByExample(exampleDoc{Name: "John", Tags: []string{"a"}, Previous: []exampleAddress{{City: "y"}}}, ExampleOptions{CaseInsensitive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := map[string]interface{}{"name": "john", "tags": []interface{}{"a", "b"},
+		"previous": []interface{}{map[string]interface{}{"city": "x"}, map[string]interface{}{"city": "y"}}}
+	if ok, err := q.Matches(doc); err != nil || !ok {
+		t.Errorf("Expected match: %v", err)
+	}
+	doc["name"] = "johnny"
+	if ok, _ := q.Matches(doc); ok {
+		t.Errorf("Unexpected match")
+	}
+}
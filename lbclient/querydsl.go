@@ -0,0 +1,882 @@
+package lbclient
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ParseQuery parses a query expression written in the query
+// language, and returns the same query the query constructors
+// build. For example:
+//
+//	status = 'active' and (age >= 21 or name =~ /^a/i) and tags any ['x','y']
+//
+// The language is:
+//
+//	expr       := andExpr { "or" andExpr }
+//	andExpr    := unaryExpr { "and" unaryExpr }
+//	unaryExpr  := "not" unaryExpr | "(" expr ")" | predicate
+//	predicate  := field relop value               CmpValue
+//	            | field relop field               CmpField
+//	            | field "=~" /pattern/flags       CmpRegex
+//	            | field ["not"] "in" list         CmpValueList
+//	            | field "nin" list                CmpValueList
+//	            | field ["not"] "in" field        CmpFieldValues
+//	            | field "nin" field               CmpFieldValues
+//	            | field ("any"|"all"|"none") list ArrayContainsList
+//	            | field "elemMatch" "(" expr ")"  ArrayMatch
+//	relop      := "=" | "==" | "!=" | "<>" | "<" | "<=" | ">" | ">="
+//	list       := "[" [ value { "," value } ] "]"
+//	value      := string | number | "true" | "false" | "null"
+//
+// Fields are dotted paths such as a.b.*.c, or any text between
+// backquotes, with backquotes in the text doubled. Strings are single or double quoted, with backslash
+// escapes. Regex flags are i (case insensitive), x (extended), m
+// (multiline) and s (dotall). Keywords are case insensitive.
+//
+// Syntax errors are returned as *QuerySyntaxError.
+func ParseQuery(s string) (*Query, error) {
+	p := queryParser{s: s}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	t, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind != tokEOF {
+		return nil, p.errorf(t.pos, "unexpected %s", t)
+	}
+	return q, nil
+}
+
+// MustParseQuery is like ParseQuery, but panics if the query cannot
+// be parsed
+func MustParseQuery(s string) *Query {
+	q, err := ParseQuery(s)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// QuerySyntaxError is returned by ParseQuery for malformed
+// expressions. Offset is the byte offset of the error in the input,
+// Line and Column are 1-based
+type QuerySyntaxError struct {
+	Offset int
+	Line   int
+	Column int
+	Msg    string
+}
+
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("query syntax error at %d:%d: %s", e.Line, e.Column, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokQuotedIdent
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of query"
+	case tokString:
+		return "string " + quoteDSLString(t.text)
+	case tokQuotedIdent:
+		return formatQuotedField(t.text)
+	default:
+		return "'" + t.text + "'"
+	}
+}
+
+// isKeyword returns if t is the unquoted keyword kw
+func (t token) isKeyword(kw string) bool {
+	return t.kind == tokIdent && strings.EqualFold(t.text, kw)
+}
+
+var dslKeywords = []string{"and", "or", "not", "in", "nin", "any", "all", "none", "elemmatch", "true", "false", "null"}
+
+type queryParser struct {
+	s      string
+	pos    int
+	peeked *token
+}
+
+func (p *queryParser) errorf(pos int, format string, args ...interface{}) error {
+	line, col := 1, 1
+	for _, r := range p.s[:pos] {
+		if r == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return &QuerySyntaxError{Offset: pos, Line: line, Column: col, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.s) {
+		r, n := utf8.DecodeRuneInString(p.s[p.pos:])
+		if !unicode.IsSpace(r) {
+			return
+		}
+		p.pos += n
+	}
+}
+
+func (p *queryParser) peek() (token, error) {
+	if p.peeked == nil {
+		t, err := p.scan()
+		if err != nil {
+			return t, err
+		}
+		p.peeked = &t
+	}
+	return *p.peeked, nil
+}
+
+// next consumes the peeked token. It must only be called after a
+// successful peek
+func (p *queryParser) next() token {
+	t := *p.peeked
+	p.peeked = nil
+	return t
+}
+
+func isIdentStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '$' || r == '*'
+}
+
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r) || r == '.' || r == '#'
+}
+
+func (p *queryParser) scan() (token, error) {
+	p.skipSpace()
+	start := p.pos
+	if p.pos >= len(p.s) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+	r, n := utf8.DecodeRuneInString(p.s[p.pos:])
+	switch {
+	case r == '(':
+		p.pos++
+		return token{kind: tokLParen, text: "(", pos: start}, nil
+	case r == ')':
+		p.pos++
+		return token{kind: tokRParen, text: ")", pos: start}, nil
+	case r == '[':
+		p.pos++
+		return token{kind: tokLBracket, text: "[", pos: start}, nil
+	case r == ']':
+		p.pos++
+		return token{kind: tokRBracket, text: "]", pos: start}, nil
+	case r == ',':
+		p.pos++
+		return token{kind: tokComma, text: ",", pos: start}, nil
+	case r == '\'' || r == '"':
+		s, err := p.scanString(r)
+		return token{kind: tokString, text: s, pos: start}, err
+	case r == '`':
+		var b strings.Builder
+		p.pos++
+		for {
+			end := strings.IndexByte(p.s[p.pos:], '`')
+			if end < 0 {
+				return token{}, p.errorf(start, "unterminated quoted field")
+			}
+			b.WriteString(p.s[p.pos : p.pos+end])
+			p.pos += end + 1
+			// A doubled backquote is a backquote in the field name
+			if p.pos < len(p.s) && p.s[p.pos] == '`' {
+				b.WriteByte('`')
+				p.pos++
+				continue
+			}
+			break
+		}
+		if b.Len() == 0 {
+			return token{}, p.errorf(start, "empty quoted field")
+		}
+		return token{kind: tokQuotedIdent, text: b.String(), pos: start}, nil
+	case unicode.IsDigit(r) || (r == '-' && p.pos+1 < len(p.s) && p.s[p.pos+1] >= '0' && p.s[p.pos+1] <= '9'):
+		return p.scanNumber()
+	case isIdentStart(r):
+		p.pos += n
+		for p.pos < len(p.s) {
+			r, n := utf8.DecodeRuneInString(p.s[p.pos:])
+			if !isIdentPart(r) {
+				break
+			}
+			p.pos += n
+		}
+		return token{kind: tokIdent, text: p.s[start:p.pos], pos: start}, nil
+	}
+	for _, op := range []string{"==", "!=", "<>", "<=", ">=", "=~", "=", "<", ">"} {
+		if strings.HasPrefix(p.s[p.pos:], op) {
+			p.pos += len(op)
+			return token{kind: tokOp, text: op, pos: start}, nil
+		}
+	}
+	return token{}, p.errorf(start, "unexpected character %q", r)
+}
+
+func (p *queryParser) scanString(quote rune) (string, error) {
+	start := p.pos
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.s) {
+		r, n := utf8.DecodeRuneInString(p.s[p.pos:])
+		p.pos += n
+		switch r {
+		case quote:
+			return b.String(), nil
+		case '\\':
+			if p.pos >= len(p.s) {
+				return "", p.errorf(start, "unterminated string")
+			}
+			esc := p.s[p.pos]
+			p.pos++
+			switch esc {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case '\\', '\'', '"', '/':
+				b.WriteByte(esc)
+			case 'u':
+				if p.pos+4 > len(p.s) {
+					return "", p.errorf(p.pos-2, "invalid unicode escape")
+				}
+				code, err := strconv.ParseUint(p.s[p.pos:p.pos+4], 16, 32)
+				if err != nil {
+					return "", p.errorf(p.pos-2, "invalid unicode escape")
+				}
+				b.WriteRune(rune(code))
+				p.pos += 4
+			default:
+				return "", p.errorf(p.pos-2, "invalid escape \\%c", esc)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return "", p.errorf(start, "unterminated string")
+}
+
+// scanNumber scans a JSON number
+func (p *queryParser) scanNumber() (token, error) {
+	start := p.pos
+	digits := func() int {
+		n := 0
+		for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+			p.pos++
+			n++
+		}
+		return n
+	}
+	if p.s[p.pos] == '-' {
+		p.pos++
+	}
+	digits()
+	if p.pos < len(p.s) && p.s[p.pos] == '.' {
+		p.pos++
+		if digits() == 0 {
+			return token{}, p.errorf(start, "invalid number %s", p.s[start:p.pos])
+		}
+	}
+	if p.pos < len(p.s) && (p.s[p.pos] == 'e' || p.s[p.pos] == 'E') {
+		p.pos++
+		if p.pos < len(p.s) && (p.s[p.pos] == '+' || p.s[p.pos] == '-') {
+			p.pos++
+		}
+		if digits() == 0 {
+			return token{}, p.errorf(start, "invalid number %s", p.s[start:p.pos])
+		}
+	}
+	text := p.s[start:p.pos]
+	if (len(text) > 1 && text[0] == '0' && text[1] >= '0' && text[1] <= '9') ||
+		(len(text) > 2 && text[0] == '-' && text[1] == '0' && text[2] >= '0' && text[2] <= '9') {
+		return token{}, p.errorf(start, "invalid number %s", text)
+	}
+	if p.pos < len(p.s) {
+		if r, _ := utf8.DecodeRuneInString(p.s[p.pos:]); isIdentPart(r) {
+			return token{}, p.errorf(start, "invalid number %s%c", text, r)
+		}
+	}
+	return token{kind: tokNumber, text: text, pos: start}, nil
+}
+
+// scanRegex scans /pattern/flags. An escaped slash in the pattern is
+// unescaped, other escapes are passed to the pattern as is
+func (p *queryParser) scanRegex() (string, RegexOptions, error) {
+	var options RegexOptions
+	p.skipSpace()
+	start := p.pos
+	if p.pos >= len(p.s) || p.s[p.pos] != '/' {
+		return "", options, p.errorf(start, "expected /pattern/")
+	}
+	p.pos++
+	var b strings.Builder
+	for {
+		if p.pos >= len(p.s) {
+			return "", options, p.errorf(start, "unterminated regular expression")
+		}
+		c := p.s[p.pos]
+		p.pos++
+		if c == '/' {
+			break
+		}
+		if c == '\\' && p.pos < len(p.s) {
+			if p.s[p.pos] != '/' {
+				b.WriteByte(c)
+			}
+			c = p.s[p.pos]
+			p.pos++
+		}
+		b.WriteByte(c)
+	}
+	for p.pos < len(p.s) {
+		r, n := utf8.DecodeRuneInString(p.s[p.pos:])
+		var opt *bool
+		switch r {
+		case 'i':
+			opt = &options.CaseInsensitive
+		case 'x':
+			opt = &options.Extended
+		case 'm':
+			opt = &options.Multiline
+		case 's':
+			opt = &options.Dotall
+		default:
+			if isIdentPart(r) {
+				return "", options, p.errorf(p.pos, "invalid regex flag %q", r)
+			}
+			return b.String(), options, nil
+		}
+		*opt = true
+		p.pos += n
+	}
+	return b.String(), options, nil
+}
+
+// expect returns the next token if it is of the given kind
+func (p *queryParser) expect(kind tokenKind, what string) (token, error) {
+	t, err := p.peek()
+	if err != nil {
+		return t, err
+	}
+	if t.kind != kind {
+		return t, p.errorf(t.pos, "expected %s, got %s", what, t)
+	}
+	return p.next(), nil
+}
+
+func (p *queryParser) parseOr() (*Query, error) {
+	return p.parseList("or", p.parseAnd, OrList)
+}
+
+func (p *queryParser) parseAnd() (*Query, error) {
+	return p.parseList("and", p.parseUnary, AndList)
+}
+
+// parseList parses operands separated by the keyword kw
+func (p *queryParser) parseList(kw string, operand func() (*Query, error), build func([]*Query) *Query) (*Query, error) {
+	q, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	list := []*Query{q}
+	for {
+		t, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if !t.isKeyword(kw) {
+			break
+		}
+		p.next()
+		if q, err = operand(); err != nil {
+			return nil, err
+		}
+		list = append(list, q)
+	}
+	if len(list) == 1 {
+		return list[0], nil
+	}
+	return build(list), nil
+}
+
+func (p *queryParser) parseUnary() (*Query, error) {
+	t, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case t.isKeyword("not"):
+		p.next()
+		q, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(q), nil
+	case t.kind == tokLParen:
+		p.next()
+		return p.parseParenRest()
+	}
+	return p.parsePredicate()
+}
+
+// parseParenRest parses an expression followed by a closing paren
+func (p *queryParser) parseParenRest() (*Query, error) {
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokRParen, "')'"); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// isField returns if t can be used as a field name
+func isField(t token) bool {
+	if t.kind == tokQuotedIdent {
+		return true
+	}
+	if t.kind != tokIdent {
+		return false
+	}
+	for _, kw := range dslKeywords {
+		if t.isKeyword(kw) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *queryParser) parsePredicate() (*Query, error) {
+	t, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if !isField(t) {
+		return nil, p.errorf(t.pos, "expected field, got %s", t)
+	}
+	field := p.next().text
+	t, err = p.peek()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case t.kind == tokOp && t.text == "=~":
+		p.next()
+		pattern, options, err := p.scanRegex()
+		if err != nil {
+			return nil, err
+		}
+		return CmpRegex(field, pattern, options), nil
+	case t.kind == tokOp:
+		p.next()
+		op := dslRelationalOps[t.text]
+		rhs, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if isField(rhs) {
+			return CmpField(field, op, p.next().text), nil
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return CmpValue(field, op, value), nil
+	case t.isKeyword("in"), t.isKeyword("nin"), t.isKeyword("not"):
+		p.next()
+		op := IN
+		if t.isKeyword("nin") {
+			op = NIN
+		} else if t.isKeyword("not") {
+			op = NIN
+			if _, err := p.expectKeyword("in"); err != nil {
+				return nil, err
+			}
+		}
+		rhs, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if isField(rhs) {
+			return CmpFieldValues(field, op, p.next().text), nil
+		}
+		values, err := p.parseValueList()
+		if err != nil {
+			return nil, err
+		}
+		return CmpValueList(field, op, values), nil
+	case t.isKeyword("any"), t.isKeyword("all"), t.isKeyword("none"):
+		p.next()
+		values, err := p.parseValueList()
+		if err != nil {
+			return nil, err
+		}
+		return ArrayContainsList(field, arrayOps["$"+strings.ToLower(t.text)], values), nil
+	case t.isKeyword("elemmatch"):
+		p.next()
+		if _, err := p.expect(tokLParen, "'('"); err != nil {
+			return nil, err
+		}
+		q, err := p.parseParenRest()
+		if err != nil {
+			return nil, err
+		}
+		return ArrayMatch(field, q), nil
+	}
+	return nil, p.errorf(t.pos, "expected operator after %s, got %s", field, t)
+}
+
+func (p *queryParser) expectKeyword(kw string) (token, error) {
+	t, err := p.peek()
+	if err != nil {
+		return t, err
+	}
+	if !t.isKeyword(kw) {
+		return t, p.errorf(t.pos, "expected '%s', got %s", kw, t)
+	}
+	return p.next(), nil
+}
+
+var dslRelationalOps = map[string]RelationalOp{"=": EQ, "==": EQ, "!=": NEQ, "<>": NEQ,
+	"<": LT, "<=": LTE, ">": GT, ">=": GTE}
+
+func (p *queryParser) parseValue() (Literal, error) {
+	t, err := p.peek()
+	if err != nil {
+		return Literal{}, err
+	}
+	switch {
+	case t.kind == tokString:
+		p.next()
+		return LitStr(t.text), nil
+	case t.kind == tokNumber:
+		p.next()
+		var l Literal
+		err := l.UnmarshalJSON([]byte(t.text))
+		return l, err
+	case t.isKeyword("true"):
+		p.next()
+		return LitBool(true), nil
+	case t.isKeyword("false"):
+		p.next()
+		return LitBool(false), nil
+	case t.isKeyword("null"):
+		p.next()
+		return LitNull(), nil
+	}
+	return Literal{}, p.errorf(t.pos, "expected value, got %s", t)
+}
+
+func (p *queryParser) parseValueList() ([]Literal, error) {
+	if _, err := p.expect(tokLBracket, "'['"); err != nil {
+		return nil, err
+	}
+	values := make([]Literal, 0)
+	t, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind == tokRBracket {
+		p.next()
+		return values, nil
+	}
+	for {
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		t, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == tokRBracket {
+			p.next()
+			return values, nil
+		}
+		if t.kind != tokComma {
+			return nil, p.errorf(t.pos, "expected ',' or ']', got %s", t)
+		}
+		p.next()
+	}
+}
+
+// FormatQuery returns the query in the query language accepted by
+// ParseQuery. Parsing the returned string builds the same
+// query. Queries containing object or array literals cannot be
+// written in the query language, and return an error
+func FormatQuery(q *Query) (string, error) {
+	var b strings.Builder
+	if err := formatQuery(&b, q, precOr); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Operator precedence, from loosest to tightest binding
+const (
+	precOr = iota
+	precAnd
+	precUnary
+)
+
+func formatQuery(b *strings.Builder, q *Query, prec int) error {
+	if q == nil || len(q.q) == 0 {
+		return fmt.Errorf("Cannot format empty query")
+	}
+	if list, ok := q.q["$or"]; ok {
+		return formatList(b, list, "or", precOr, prec)
+	}
+	if list, ok := q.q["$and"]; ok {
+		return formatList(b, list, "and", precAnd, prec)
+	}
+	if nq, ok := q.q["$not"]; ok {
+		x, ok := nq.(Query)
+		if !ok {
+			return fmt.Errorf("Invalid $not: %v", nq)
+		}
+		b.WriteString("not ")
+		return formatQuery(b, &x, precUnary)
+	}
+	if array, ok := q.q["array"]; ok {
+		b.WriteString(formatDSLField(fmt.Sprint(array)))
+		if em, ok := q.q["elemMatch"]; ok {
+			x, ok := em.(Query)
+			if !ok {
+				return fmt.Errorf("Invalid elemMatch: %v", em)
+			}
+			b.WriteString(" elemMatch (")
+			if err := formatQuery(b, &x, precOr); err != nil {
+				return err
+			}
+			b.WriteString(")")
+			return nil
+		}
+		b.WriteString(" ")
+		b.WriteString(strings.TrimPrefix(fmt.Sprint(q.q["contains"]), "$"))
+		b.WriteString(" ")
+		return formatValueList(b, q.q["values"])
+	}
+	field := formatDSLField(fmt.Sprint(q.q["field"]))
+	if pattern, ok := q.q["regex"]; ok {
+		b.WriteString(field)
+		b.WriteString(" =~ /")
+		b.WriteString(formatDSLRegex(fmt.Sprint(pattern)))
+		b.WriteString("/")
+		for _, x := range []struct{ name, flag string }{{"caseInsensitive", "i"}, {"extended", "x"}, {"multiline", "m"}, {"dotall", "s"}} {
+			if v, _ := q.q[x.name].(bool); v {
+				b.WriteString(x.flag)
+			}
+		}
+		return nil
+	}
+	b.WriteString(field)
+	switch op := q.q["op"].(type) {
+	case RelationalOp:
+		b.WriteString(" ")
+		b.WriteString(string(op))
+		b.WriteString(" ")
+		if rfield, ok := q.q["rfield"]; ok {
+			b.WriteString(formatDSLField(fmt.Sprint(rfield)))
+			return nil
+		}
+		l, ok := q.q["rvalue"].(Literal)
+		if !ok {
+			return fmt.Errorf("Invalid rvalue: %v", q.q["rvalue"])
+		}
+		return formatLiteral(b, l)
+	case NaryOp:
+		if op == NIN {
+			b.WriteString(" not in ")
+		} else {
+			b.WriteString(" in ")
+		}
+		if rfield, ok := q.q["rfield"]; ok {
+			b.WriteString(formatDSLField(fmt.Sprint(rfield)))
+			return nil
+		}
+		return formatValueList(b, q.q["values"])
+	}
+	return fmt.Errorf("Cannot format query %s", q)
+}
+
+func formatList(b *strings.Builder, list interface{}, kw string, listPrec, prec int) error {
+	queries, ok := list.([]Query)
+	if !ok || len(queries) == 0 {
+		return fmt.Errorf("Cannot format empty %s", kw)
+	}
+	if len(queries) == 1 {
+		return formatQuery(b, &queries[0], prec)
+	}
+	if prec > listPrec {
+		b.WriteString("(")
+	}
+	for i := range queries {
+		if i > 0 {
+			b.WriteString(" " + kw + " ")
+		}
+		// Nested lists of the same kind are parenthesized to keep
+		// the query structure
+		if err := formatQuery(b, &queries[i], listPrec+1); err != nil {
+			return err
+		}
+	}
+	if prec > listPrec {
+		b.WriteString(")")
+	}
+	return nil
+}
+
+func formatValueList(b *strings.Builder, v interface{}) error {
+	values, ok := v.([]Literal)
+	if !ok {
+		return fmt.Errorf("Invalid values: %v", v)
+	}
+	b.WriteString("[")
+	for i, l := range values {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if err := formatLiteral(b, l); err != nil {
+			return err
+		}
+	}
+	b.WriteString("]")
+	return nil
+}
+
+func formatLiteral(b *strings.Builder, l Literal) error {
+	switch l.which {
+	case 0:
+		b.WriteString(strconv.Itoa(l.i))
+	case 1:
+		b.WriteString(quoteDSLString(l.s))
+	case 2:
+		s := strconv.FormatFloat(float64(l.d), 'g', -1, 32)
+		if !strings.ContainsAny(s, ".eE") {
+			// Keep it a double when parsed back
+			s += ".0"
+		}
+		b.WriteString(s)
+	case 3:
+		b.WriteString(strconv.FormatBool(l.b))
+	case 4:
+		var p queryParser
+		p.s = strings.TrimSpace(string(l.j))
+		if t, err := p.scan(); err != nil || t.kind != tokNumber || p.pos != len(p.s) {
+			return fmt.Errorf("Cannot format literal %s", string(l.j))
+		}
+		b.WriteString(p.s)
+	default:
+		b.WriteString("null")
+	}
+	return nil
+}
+
+func quoteDSLString(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\'', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString("\\n")
+		case '\t':
+			b.WriteString("\\t")
+		case '\r':
+			b.WriteString("\\r")
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(&b, "\\u%04x", r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// formatDSLField returns the field name, quoted if it is a keyword
+// or contains characters not allowed in unquoted fields
+func formatDSLField(f string) string {
+	t := token{kind: tokIdent, text: f}
+	quote := !isField(t) || len(f) == 0
+	for i, r := range f {
+		if (i == 0 && !isIdentStart(r)) || !isIdentPart(r) {
+			quote = true
+			break
+		}
+	}
+	if quote {
+		return formatQuotedField(f)
+	}
+	return f
+}
+
+// formatQuotedField returns the field name between backquotes, with
+// backquotes doubled
+func formatQuotedField(f string) string {
+	return "`" + strings.ReplaceAll(f, "`", "``") + "`"
+}
+
+// formatDSLRegex escapes unescaped slashes in the pattern
+func formatDSLRegex(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c == '\\' && i+1 < len(pattern) {
+			b.WriteByte(c)
+			b.WriteByte(pattern[i+1])
+			i++
+			continue
+		}
+		if c == '/' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,136 @@
+package lbclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func ExampleParseQuery() {
+	q, err := ParseQuery("status = 'active' and (age >= 21 or name =~ /^a/i) and tags any ['x','y']")
+	if err != nil {
+		panic(err)
+	}
+	s, _ := FormatQuery(q)
+	fmt.Println(s)
+	// Output: status = 'active' and (age >= 21 or name =~ /^a/i) and tags any ['x', 'y']
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected *Query
+	}{
+		{"a = 1", CmpValue("a", EQ, LitInt(1))},
+		{"a == 'x'", CmpValue("a", EQ, LitStr("x"))},
+		{`a <> "x\"y"`, CmpValue("a", NEQ, LitStr(`x"y`))},
+		{"a < -1.5", CmpValue("a", LT, LitDouble(-1.5))},
+		{"a <= 2.0", CmpValue("a", LTE, LitDouble(2))},
+		{"a > true", CmpValue("a", GT, LitBool(true))},
+		{"a >= null", CmpValue("a", GTE, LitNull())},
+		{"a.b.*.c = b", CmpField("a.b.*.c", EQ, "b")},
+		{"`and` = `x y`", CmpField("and", EQ, "x y")},
+		{"`a``b` = ````", CmpField("a`b", EQ, "`")},
+		{"a in [1, 2, 3]", CmpValues("a", IN, LitInts(1, 2, 3)...)},
+		{"a not in ['x']", CmpValues("a", NIN, LitStr("x"))},
+		{"a nin []", CmpValueList("a", NIN, []Literal{})},
+		{"a IN b", CmpFieldValues("a", IN, "b")},
+		{"a =~ /x\\/y\\d/ixms", CmpRegex("a", "x/y\\d", RegexOptions{true, true, true, true})},
+		{"arr all [1,'x']", ArrayContains("arr", ALL, LitInt(1), LitStr("x"))},
+		{"arr none []", ArrayContainsList("arr", NONE, []Literal{})},
+		{"arr elemMatch (x = 1 and y = $parent.z)", ArrayMatch("arr", And(CmpValue("x", EQ, LitInt(1)), CmpField("y", EQ, "$parent.z")))},
+		{"not a = 1", Not(CmpValue("a", EQ, LitInt(1)))},
+		{"not (a = 1 or b = 2)", Not(Or(CmpValue("a", EQ, LitInt(1)), CmpValue("b", EQ, LitInt(2))))},
+		{"a = 1 or b = 2 and c = 3", Or(CmpValue("a", EQ, LitInt(1)), And(CmpValue("b", EQ, LitInt(2)), CmpValue("c", EQ, LitInt(3))))},
+		{"(a = 1 and b = 2) and c = 3", And(And(CmpValue("a", EQ, LitInt(1)), CmpValue("b", EQ, LitInt(2))), CmpValue("c", EQ, LitInt(3)))},
+	}
+	for _, test := range tests {
+		q, err := ParseQuery(test.in)
+		if err != nil {
+			t.Errorf("%s: %s", test.in, err)
+			continue
+		}
+		actual, _ := json.Marshal(q)
+		expected, _ := json.Marshal(test.expected)
+		if string(actual) != string(expected) {
+			t.Errorf("%s: expected %s, got %s", test.in, string(expected), string(actual))
+		}
+		// Formatting and parsing again must build the same query
+		s, err := FormatQuery(q)
+		if err != nil {
+			t.Errorf("%s: %s", test.in, err)
+			continue
+		}
+		q2, err := ParseQuery(s)
+		if err != nil {
+			t.Errorf("%s: cannot parse formatted query %s: %s", test.in, s, err)
+			continue
+		}
+		actual, _ = json.Marshal(q2)
+		if string(actual) != string(expected) {
+			t.Errorf("%s: formatted as %s, parsed as %s", test.in, s, string(actual))
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		in        string
+		line, col int
+	}{
+		{"", 1, 1},
+		{"a =", 1, 4},
+		{"a = 1 and", 1, 10},
+		{"a = 1 b = 2", 1, 7},
+		{"a ? 1", 1, 3},
+		{"a = 'x", 1, 5},
+		{"a in [1 2]", 1, 9},
+		{"(a = 1", 1, 7},
+		{"a = 1 and\n  b =~ /x", 2, 8},
+		{"a =~ /x/q", 1, 9},
+		{"a = 01", 1, 5},
+		{"not = 1", 1, 5},
+		{"a = 'x\\q'", 1, 7},
+		{"`a``", 1, 1},
+	}
+	for _, test := range tests {
+		_, err := ParseQuery(test.in)
+		serr, ok := err.(*QuerySyntaxError)
+		if !ok {
+			t.Errorf("%q: expected syntax error, got %v", test.in, err)
+			continue
+		}
+		if serr.Line != test.line || serr.Column != test.col {
+			t.Errorf("%q: expected error at %d:%d, got %s", test.in, test.line, test.col, serr)
+		}
+	}
+}
+
+func TestFormatQuery(t *testing.T) {
+	tests := []struct {
+		q        *Query
+		expected string
+	}{
+		{CmpValue("a", EQ, LitStr("it's\n")), `a = 'it\'s\n'`},
+		{CmpValue("a b", EQ, LitDouble(3)), "`a b` = 3.0"},
+		{CmpField("a`b", EQ, "`"), "`a``b` = ````"},
+		{CmpRegex("a", "x/y", RegexOptions{Dotall: true}), `a =~ /x\/y/s`},
+		{CmpValues("a", NIN, LitInts(1, 2)...), "a not in [1, 2]"},
+		{And(Or(CmpField("a", EQ, "b"), CmpField("c", EQ, "d")), Not(CmpValue("e", EQ, LitNull()))), "(a = b or c = d) and not e = null"},
+		{Or(Or(CmpField("a", EQ, "b")), CmpField("c", EQ, "d")), "a = b or c = d"},
+	}
+	for _, test := range tests {
+		s, err := FormatQuery(test.q)
+		if err != nil {
+			t.Errorf("%s: %s", test.q, err)
+		} else if s != test.expected {
+			t.Errorf("Expected %s, got %s", test.expected, s)
+		}
+	}
+	if _, err := FormatQuery(CmpValue("a", EQ, LitJson([]byte(`{"x":1}`)))); err == nil {
+		t.Errorf("Expected error for object literal")
+	}
+	if _, err := FormatQuery(&Query{}); err == nil {
+		t.Errorf("Expected error for empty query")
+	}
+}
@@ -0,0 +1,243 @@
+package lbclient
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Simplify returns a simplified, canonical version of the query that
+// matches the same documents. It
+//
+//   - flattens nested $and and $or queries, and replaces single
+//     element $and and $or queries with the element,
+//   - removes duplicate predicates and literal values,
+//   - merges EQ and IN comparisons of the same field in a $or into an
+//     IN comparison, and NEQ and NIN comparisons of the same field in
+//     an $and into a NIN comparison,
+//   - pushes $not down to the comparisons, removes double negation,
+//     and negates EQ, NEQ, IN and NIN comparisons by changing the
+//     operator,
+//   - sorts $and and $or elements, and IN, NIN and array contains
+//     values, so equivalent queries marshal identically.
+//
+// Comparisons of fields containing * match if any of the array
+// elements satisfy the comparison, so negating them changes the
+// meaning of the query. Such comparisons are negated with $not, and
+// NEQ comparisons of such fields are not merged. If the query cannot
+// be parsed, it is returned as is
+func Simplify(q *Query) *Query {
+	node, err := q.AST()
+	if err != nil || node == nil {
+		return q
+	}
+	return simplify(node).ToQuery()
+}
+
+func simplify(node QueryNode) QueryNode {
+	switch n := node.(type) {
+	case NotExpr:
+		return negate(simplify(n.Query))
+	case AndExpr:
+		return simplifyList(simplifyAll(n.Queries), true)
+	case OrExpr:
+		return simplifyList(simplifyAll(n.Queries), false)
+	case ArrayMatchExpr:
+		return ArrayMatchExpr{Array: n.Array, Query: simplify(n.Query)}
+	case ValueListComparison:
+		return valueList(n.Field, n.Op, n.Values)
+	case ArrayContainsExpr:
+		return ArrayContainsExpr{Array: n.Array, Op: n.Op, Values: canonicalLiterals(n.Values)}
+	}
+	return node
+}
+
+func simplifyAll(nodes []QueryNode) []QueryNode {
+	ret := make([]QueryNode, len(nodes))
+	for i, n := range nodes {
+		ret[i] = simplify(n)
+	}
+	return ret
+}
+
+// negate returns the negation of a simplified node
+func negate(node QueryNode) QueryNode {
+	switch n := node.(type) {
+	case NotExpr:
+		return n.Query
+	case AndExpr:
+		return simplifyList(negateAll(n.Queries), false)
+	case OrExpr:
+		return simplifyList(negateAll(n.Queries), true)
+	case ValueComparison:
+		if op, ok := negatedOps[n.Op]; ok && !hasWildcard(n.Field) {
+			n.Op = op
+			return n
+		}
+	case FieldComparison:
+		if op, ok := negatedOps[n.Op]; ok && !hasWildcard(n.Field) && !hasWildcard(n.RField) {
+			n.Op = op
+			return n
+		}
+	case ValueListComparison:
+		if !hasWildcard(n.Field) {
+			n.Op = negateNary(n.Op)
+			return n
+		}
+	case FieldListComparison:
+		if !hasWildcard(n.Field) && !hasWildcard(n.RField) {
+			n.Op = negateNary(n.Op)
+			return n
+		}
+	}
+	return NotExpr{Query: node}
+}
+
+func negateAll(nodes []QueryNode) []QueryNode {
+	ret := make([]QueryNode, len(nodes))
+	for i, n := range nodes {
+		ret[i] = negate(n)
+	}
+	return ret
+}
+
+var negatedOps = map[RelationalOp]RelationalOp{EQ: NEQ, NEQ: EQ}
+
+func negateNary(op NaryOp) NaryOp {
+	if op == IN {
+		return NIN
+	}
+	return IN
+}
+
+func hasWildcard(field string) bool {
+	for _, s := range strings.Split(field, ".") {
+		if s == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// simplifyList builds a simplified $and (and=true) or $or
+// (and=false) from simplified nodes
+func simplifyList(nodes []QueryNode, and bool) QueryNode {
+	var flat []QueryNode
+	for _, n := range nodes {
+		switch x := n.(type) {
+		case AndExpr:
+			if and {
+				flat = append(flat, x.Queries...)
+				continue
+			}
+		case OrExpr:
+			if !and {
+				flat = append(flat, x.Queries...)
+				continue
+			}
+		}
+		flat = append(flat, n)
+	}
+	flat = mergeComparisons(flat, and)
+
+	seen := make(map[string]bool)
+	keys := make(map[string]QueryNode)
+	var sorted []string
+	for _, n := range flat {
+		k := nodeKey(n)
+		if !seen[k] {
+			seen[k] = true
+			keys[k] = n
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Strings(sorted)
+	if len(sorted) == 1 {
+		return keys[sorted[0]]
+	}
+	ret := make([]QueryNode, len(sorted))
+	for i, k := range sorted {
+		ret[i] = keys[k]
+	}
+	if and {
+		return AndExpr{Queries: ret}
+	}
+	return OrExpr{Queries: ret}
+}
+
+// mergeComparisons merges EQ and IN comparisons of the same field in
+// a $or, and NEQ and NIN comparisons of the same field without
+// wildcards in an $and
+func mergeComparisons(nodes []QueryNode, and bool) []QueryNode {
+	relOp, naryOp := EQ, IN
+	if and {
+		relOp, naryOp = NEQ, NIN
+	}
+	var ret []QueryNode
+	values := make(map[string][]Literal)
+	var fields []string
+	add := func(field string, v ...Literal) {
+		if _, ok := values[field]; !ok {
+			fields = append(fields, field)
+		}
+		values[field] = append(values[field], v...)
+	}
+	for _, n := range nodes {
+		switch x := n.(type) {
+		case ValueComparison:
+			if x.Op == relOp && !(and && hasWildcard(x.Field)) {
+				add(x.Field, x.Value)
+				continue
+			}
+		case ValueListComparison:
+			if x.Op == naryOp && !(and && hasWildcard(x.Field)) {
+				add(x.Field, x.Values...)
+				continue
+			}
+		}
+		ret = append(ret, n)
+	}
+	for _, f := range fields {
+		ret = append(ret, valueList(f, naryOp, values[f]))
+	}
+	return ret
+}
+
+// valueList returns a value list comparison with canonical values. A
+// single value comparison is returned as EQ or NEQ
+func valueList(field string, op NaryOp, values []Literal) QueryNode {
+	values = canonicalLiterals(values)
+	if len(values) == 1 {
+		if op == IN {
+			return ValueComparison{Field: field, Op: EQ, Value: values[0]}
+		}
+		return ValueComparison{Field: field, Op: NEQ, Value: values[0]}
+	}
+	return ValueListComparison{Field: field, Op: op, Values: values}
+}
+
+// canonicalLiterals returns the sorted literal values without
+// duplicates
+func canonicalLiterals(values []Literal) []Literal {
+	byKey := make(map[string]Literal, len(values))
+	keys := make([]string, 0, len(values))
+	for _, v := range values {
+		k := v.String()
+		if _, ok := byKey[k]; !ok {
+			byKey[k] = v
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	ret := make([]Literal, len(keys))
+	for i, k := range keys {
+		ret[i] = byKey[k]
+	}
+	return ret
+}
+
+// nodeKey returns the canonical representation of a node
+func nodeKey(n QueryNode) string {
+	b, _ := json.Marshal(n.ToQuery())
+	return string(b)
+}
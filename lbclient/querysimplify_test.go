@@ -0,0 +1,70 @@
+package lbclient
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	tests := []struct {
+		in, expected string
+	}{
+		{"a = 1", "a = 1"},
+		{"(a = 1 and b = 2) and (c = 3 and (d = 4))", "a = 1 and b = 2 and c = 3 and d = 4"},
+		{"b = 1 and a = 1 and b = 1", "a = 1 and b = 1"},
+		{"not not a = 1", "a = 1"},
+		{"not a = 1", "a != 1"},
+		{"not a in [2, 1]", "a not in [1, 2]"},
+		{"not a.*.b = 1", "not a.*.b = 1"},
+		{"not (a = 1 or b != c)", "a != 1 and b = c"},
+		{"not (a < 1 and b = 2)", "not a < 1 or b != 2"},
+		{"a = 1 or a = 2 or b = 3 or a in [3, 1]", "a in [1, 2, 3] or b = 3"},
+		{"a != 1 and a not in [2]", "a not in [1, 2]"},
+		{"a.*.b != 1 and a.*.b != 2", "a.*.b != 1 and a.*.b != 2"},
+		{"a.*.b = 1 or a.*.b = 2", "a.*.b in [1, 2]"},
+		{"a in [1, 1]", "a = 1"},
+		{"tags any ['b', 'a', 'b']", "tags any ['a', 'b']"},
+		{"arr elemMatch (not not (x = 1 or x = 2))", "arr elemMatch (x in [1, 2])"},
+	}
+	for _, test := range tests {
+		s, err := FormatQuery(Simplify(MustParseQuery(test.in)))
+		if err != nil {
+			t.Errorf("%s: %s", test.in, err)
+		} else if s != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.in, test.expected, s)
+		}
+	}
+}
+
+func TestSimplifyCanonical(t *testing.T) {
+	a, _ := json.Marshal(Simplify(MustParseQuery("(x = 1 or y = 2) and z in [3, 2] and w = 1")))
+	b, _ := json.Marshal(Simplify(MustParseQuery("w = 1 and (z = 2 or z = 3) and (y = 2 or x = 1)")))
+	if string(a) != string(b) {
+		t.Errorf("Expected identical queries: %s, %s", string(a), string(b))
+	}
+}
+
+func TestSimplifyMatches(t *testing.T) {
+	docs := []map[string]interface{}{
+		{"a": 1, "b": 2, "arr": []interface{}{map[string]interface{}{"x": 1}}},
+		{"a": 2, "b": 2},
+		{"b": 3},
+		{"a": nil, "arr": []interface{}{map[string]interface{}{"x": 3}}},
+	}
+	for _, s := range []string{
+		"not (a = 1 or b != 2)",
+		"not (a in [1, 2] and b = 2)",
+		"a = 1 or a = 2 or a = null",
+		"not (arr elemMatch (x = 1) or a != 2)",
+	} {
+		q := MustParseQuery(s)
+		simple := Simplify(q)
+		for _, doc := range docs {
+			r1, err1 := q.Matches(doc)
+			r2, err2 := simple.Matches(doc)
+			if err1 != nil || err2 != nil || r1 != r2 {
+				t.Errorf("%s: %v: got %t, simplified %s got %t", s, doc, r1, simple, r2)
+			}
+		}
+	}
+}
@@ -139,21 +139,23 @@ type InsertRequest struct {
 // * If v is nil, MakeDocData returns nil
 // * If v is a []byte, it assumes the documents are already JSON encoded, and returns v
 // * If v is a map[string]interface{} or []map[string]interface{}, it assumes the document or the documents
-//   are converted to a msp, or maps, and marshals that into JSON
+//   are converted to a msp, or maps, and marshals that into JSON. time.Time values in maps are encoded
+//   in the lightblue date format
+// * Use Date and NullDate for date fields of structs, so they are encoded in the lightblue date format
 // * If v is a struct array, or a struct, then it marshals the structs and returns that. If there is only one
 //   struct, it is placed into an array of 1 before JSON encoding
 func MakeDocData(v interface{}) json.RawMessage {
 	if v == nil {
 		return nil
 	} else if m, ok := v.(map[string]interface{}); ok {
-		s := []map[string]interface{}{m}
+		s := []interface{}{withDates(m)}
 		ret, err := json.Marshal(s)
 		if err != nil {
 			panic(err.Error())
 		}
 		return ret
 	} else if m, ok := v.([]map[string]interface{}); ok {
-		ret, err := json.Marshal(m)
+		ret, err := json.Marshal(withDates(m))
 		if err != nil {
 			panic(err.Error())
 		}
@@ -254,3 +256,22 @@ func (r *UpdateRequest) MarshalJSON() ([]byte, error) {
 	}
 	return json.Marshal(m)
 }
+
+// UnmarshalJSON decodes a range of the form [from,to]. A null to
+// means the range extends to the end of the resultset
+func (r *Range) UnmarshalJSON(data []byte) error {
+	var bounds []*int
+	if err := json.Unmarshal(data, &bounds); err != nil || len(bounds) != 2 {
+		return fmt.Errorf("Invalid range: %s", string(data))
+	}
+	if bounds[0] == nil {
+		return fmt.Errorf("Invalid range, missing from: %s", string(data))
+	}
+	r.from = *bounds[0]
+	if bounds[1] == nil {
+		r.to = MAXRANGE
+	} else {
+		r.to = *bounds[1]
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package lbclient
 
 import (
+	"encoding/json"
 	"fmt"
 )
 
@@ -37,21 +38,58 @@ func (r *Response) String() string {
 
 type ResultMd struct {
 	DocumentVersion string `json:"documentVersion"`
+	// Fields of the result metadata not known to the client. This is
+	// a pointer, so ResultMd remains comparable
+	extra *map[string]interface{}
 }
 
 func (r ResultMd) String() string {
 	return fmt.Sprintf("docver: %s", r.DocumentVersion)
 }
 
+// Extra returns the fields of the result metadata not known to the
+// client, or nil if there are none
+func (r ResultMd) Extra() map[string]interface{} {
+	return extraFields(r.extra)
+}
+
 type DataError struct {
 	EntityData []map[string]interface{} `json:"entityData"`
 	Errors     []RequestError           `json:"errors"`
+	// Fields of the data error not known to the client
+	extra *map[string]interface{}
+}
+
+func (r DataError) String() string {
+	return fmt.Sprintf("data: %v, errors: %q", r.EntityData, r.Errors)
+}
+
+// Extra returns the fields of the data error not known to the
+// client, or nil if there are none
+func (r DataError) Extra() map[string]interface{} {
+	return extraFields(r.extra)
 }
 
 type RequestError struct {
 	Context   string `json:"context"`
 	ErrorCode string `json:"errorCode"`
 	Msg       string `json:"msg"`
+	// Fields of the error not known to the client. This is a pointer,
+	// so RequestError remains comparable
+	extra *map[string]interface{}
+}
+
+// Extra returns the fields of the error not known to the client, or
+// nil if there are none
+func (r RequestError) Extra() map[string]interface{} {
+	return extraFields(r.extra)
+}
+
+func extraFields(extra *map[string]interface{}) map[string]interface{} {
+	if extra == nil {
+		return nil
+	}
+	return *extra
 }
 
 func (r RequestError) String() string {
@@ -61,3 +99,137 @@ func (r RequestError) String() string {
 func (r RequestError) Error() string {
 	return r.String()
 }
+
+// decodeFields unmarshals a JSON object, and calls known for each
+// field. If known returns false, the field is unknown, and it is
+// added to extra
+func decodeFields(data []byte, extra **map[string]interface{}, known func(name string, value json.RawMessage) (bool, error)) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for name, value := range fields {
+		ok, err := known(name, value)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		if !ok {
+			var v interface{}
+			if err := json.Unmarshal(value, &v); err != nil {
+				return fmt.Errorf("%s: %s", name, err)
+			}
+			if *extra == nil {
+				m := make(map[string]interface{})
+				*extra = &m
+			}
+			(**extra)[name] = v
+		}
+	}
+	return nil
+}
+
+// encodeFields marshals the known fields and the extra fields as a JSON object
+func encodeFields(known map[string]interface{}, extra *map[string]interface{}) ([]byte, error) {
+	m := make(map[string]interface{}, len(known))
+	for k, v := range extraFields(extra) {
+		m[k] = v
+	}
+	for k, v := range known {
+		m[k] = v
+	}
+	return json.Marshal(m)
+}
+
+// UnmarshalJSON decodes a result metadata object, keeping unknown fields in extra
+func (r *ResultMd) UnmarshalJSON(data []byte) error {
+	*r = ResultMd{}
+	return decodeFields(data, &r.extra, func(name string, value json.RawMessage) (bool, error) {
+		if name == "documentVersion" {
+			return true, json.Unmarshal(value, &r.DocumentVersion)
+		}
+		return false, nil
+	})
+}
+
+// MarshalJSON encodes a result metadata object, including the unknown fields
+func (r ResultMd) MarshalJSON() ([]byte, error) {
+	return encodeFields(map[string]interface{}{"documentVersion": r.DocumentVersion}, r.extra)
+}
+
+// UnmarshalJSON decodes a data error. The document is read from
+// entityData or data, and can be a single document or an array of
+// documents. Unknown fields are kept in extra
+func (r *DataError) UnmarshalJSON(data []byte) error {
+	*r = DataError{}
+	return decodeFields(data, &r.extra, func(name string, value json.RawMessage) (bool, error) {
+		switch name {
+		case "objectType":
+			return true, nil
+		case "errors":
+			err := json.Unmarshal(value, &r.Errors)
+			if len(r.Errors) == 0 {
+				r.Errors = nil
+			}
+			return true, err
+		case "entityData", "data":
+			docs, err := decodeDocs(value)
+			r.EntityData = append(r.EntityData, docs...)
+			return true, err
+		}
+		return false, nil
+	})
+}
+
+// MarshalJSON encodes a data error, including the unknown fields
+func (r DataError) MarshalJSON() ([]byte, error) {
+	return encodeFields(map[string]interface{}{"entityData": r.EntityData, "errors": r.Errors}, r.extra)
+}
+
+// decodeDocs decodes a document, or an array of documents
+func decodeDocs(value json.RawMessage) ([]map[string]interface{}, error) {
+	var x interface{}
+	if err := json.Unmarshal(value, &x); err != nil {
+		return nil, err
+	}
+	switch t := x.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return []map[string]interface{}{t}, nil
+	case []interface{}:
+		ret := make([]map[string]interface{}, 0, len(t))
+		for _, d := range t {
+			if m, ok := d.(map[string]interface{}); ok {
+				ret = append(ret, m)
+			} else if d != nil {
+				return nil, fmt.Errorf("Expected document, got %v", d)
+			}
+		}
+		return ret, nil
+	default:
+		return nil, fmt.Errorf("Expected document, got %v", x)
+	}
+}
+
+// UnmarshalJSON decodes an error object, keeping unknown fields in extra
+func (r *RequestError) UnmarshalJSON(data []byte) error {
+	*r = RequestError{}
+	return decodeFields(data, &r.extra, func(name string, value json.RawMessage) (bool, error) {
+		switch name {
+		case "objectType":
+			return true, nil
+		case "context":
+			return true, json.Unmarshal(value, &r.Context)
+		case "errorCode":
+			return true, json.Unmarshal(value, &r.ErrorCode)
+		case "msg":
+			return true, json.Unmarshal(value, &r.Msg)
+		}
+		return false, nil
+	})
+}
+
+// MarshalJSON encodes an error object, including the unknown fields
+func (r RequestError) MarshalJSON() ([]byte, error) {
+	return encodeFields(map[string]interface{}{"context": r.Context, "errorCode": r.ErrorCode, "msg": r.Msg}, r.extra)
+}
@@ -0,0 +1,100 @@
+package lbclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestDecodeDataErrors(t *testing.T) {
+	srv, cli := testServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"ERROR","modifiedCount":0,"matchCount":0,"hostname":"host",
+"dataErrors":[{"objectType":"dataError","data":{"_id":"1","name":"x"},
+  "errors":[{"objectType":"error","context":"rest/InsertCommand/user/insert/mongo-crud:Duplicate","errorCode":"mongo-crud:Duplicate","msg":"E11000 duplicate key"}]}],
+"errors":[]}`))
+	})
+	defer srv.Close()
+
+	resp, err := cli.Insert(&InsertRequest{RequestHeader: RequestHeader{EntityName: "user"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Errors != nil || len(resp.DataErrors) != 1 {
+		t.Fatalf("Unexpected response: %s", resp)
+	}
+	d := resp.DataErrors[0]
+	if len(d.EntityData) != 1 || d.EntityData[0]["_id"] != "1" ||
+		len(d.Errors) != 1 || d.Errors[0].ErrorCode != ERR_MONGO_DUPLICATE || d.Errors[0].Msg != "E11000 duplicate key" {
+		t.Errorf("Unexpected data error: %+v", d)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	srv, cli := testServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"ERROR","errors":[{"objectType":"error","errorCode":"crud:NoAccess","msg":"find","source":"rest"}],
+"resultMetadata":[{"documentVersion":"1:abc","lastModified":"20170102T13:14:15.123+0000"}]}`))
+	})
+	defer srv.Close()
+
+	resp, err := cli.Find(&FindRequest{RequestHeader: RequestHeader{EntityName: "user"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].ErrorCode != ERR_CRUD_NO_ACCESS || resp.Errors[0].Context != "" ||
+		resp.Errors[0].Extra()["source"] != "rest" {
+		t.Errorf("Unexpected errors: %+v", resp.Errors)
+	}
+	if len(resp.ResultMetadata) != 1 || resp.ResultMetadata[0].DocumentVersion != "1:abc" ||
+		resp.ResultMetadata[0].Extra()["lastModified"] != "20170102T13:14:15.123+0000" {
+		t.Errorf("Unexpected rmd: %+v", resp.ResultMetadata)
+	}
+}
+
+func TestDecodeMalformedError(t *testing.T) {
+	srv, cli := testServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"ERROR","errors":[{"errorCode":123}]}`))
+	})
+	defer srv.Close()
+
+	if _, err := cli.Find(&FindRequest{RequestHeader: RequestHeader{EntityName: "user"}}, nil); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestUnmarshalErrorMap(t *testing.T) {
+	var m map[string]interface{}
+	json.Unmarshal([]byte(`{"errors":[{"errorCode":"x","msg":"m"}],"entityData":[{"a":1}],"extra":true}`), &m)
+	d, err := UnmarshalDataError(m)
+	if err != nil || len(d.Errors) != 1 || d.Errors[0].ErrorCode != "x" || len(d.EntityData) != 1 || d.Extra()["extra"] != true {
+		t.Errorf("Unexpected result: %+v %v", d, err)
+	}
+	if _, err = UnmarshalError(map[string]interface{}{}); err != nil {
+		t.Error(err)
+	}
+	if _, err = UnmarshalRmd(map[string]interface{}{"documentVersion": 1}); err == nil {
+		t.Error("Expected error")
+	}
+}
+
+func TestRequestErrorRoundTrip(t *testing.T) {
+	var e RequestError
+	if err := json.Unmarshal([]byte(`{"context":"c","errorCode":"e","msg":"m","x":"y"}`), &e); err != nil {
+		t.Fatal(err)
+	}
+	cmp(t, `{"context":"c","errorCode":"e","msg":"m","x":"y"}`, e)
+	if f := e; f != e || e == (RequestError{Context: "c", ErrorCode: "e", Msg: "m"}) {
+		t.Error("Unexpected comparison")
+	}
+}
+
+func TestLockErrorDecoding(t *testing.T) {
+	srv, cli := testServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"ERROR","errors":[{"objectType":"error","errorCode":"mongo-locking:LockNotOwned","msg":"r"}]}`))
+	})
+	defer srv.Close()
+
+	_, err := cli.Release("d", "c", "r")
+	if rerr, ok := err.(RequestError); !ok || rerr.ErrorCode != ERR_LOCK_NOT_OWNED {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package lbclient
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy determines how failed HTTP calls are retried. Calls
+// that are not idempotent (insert, save, update, delete, and
+// metadata modifications) are only retried if RetryNonIdempotent is
+// set.
+type RetryPolicy struct {
+	// Maximum number of attempts, including the first one. Values
+	// less than 2 disable retries
+	MaxAttempts int
+	// Backoff before the first retry
+	InitialBackoff time.Duration
+	// Maximum backoff between attempts. Zero means no limit
+	MaxBackoff time.Duration
+	// Backoff multiplier applied after each retry. Values less than 1
+	// are treated as 2
+	Multiplier float64
+	// Jitter is the fraction of the backoff, between 0 and 1, that is
+	// randomized. With jitter j, the actual backoff for b is chosen
+	// from [b*(1-j), b*(1+j)]
+	Jitter float64
+	// Lightblue error codes that are retried
+	RetryableErrorCodes []string
+	// If true, calls that are not idempotent are also retried
+	RetryNonIdempotent bool
+	// Retryable decides if an attempt should be retried. If nil,
+	// DefaultRetryable is used
+	Retryable func(policy *RetryPolicy, attempt *CallAttempt) bool
+}
+
+// CallAttempt contains the result of a single HTTP call attempt
+type CallAttempt struct {
+	// The attempt number, starting from 1
+	Attempt int
+	// The HTTP status code, or 0 if there is a transport error
+	StatusCode int
+	// The response headers, or nil if there is a transport error
+	Header http.Header
+	// The response body
+	Body []byte
+	// The transport error, if any
+	Err error
+}
+
+// DefaultRetryPolicy retries transport errors and 5xx responses up to
+// 3 times, starting with a 100ms backoff
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// DefaultRetryable retries transport errors, HTTP 5xx responses, and
+// responses containing one of policy.RetryableErrorCodes. Context
+// cancellation is never retried.
+func DefaultRetryable(policy *RetryPolicy, attempt *CallAttempt) bool {
+	if attempt.Err != nil {
+		return attempt.Err != context.Canceled && attempt.Err != context.DeadlineExceeded
+	}
+	if attempt.StatusCode >= 500 {
+		return true
+	}
+	if len(policy.RetryableErrorCodes) == 0 {
+		return false
+	}
+	errs := decodeErrorDocument(attempt.Body)
+	for _, e := range errs {
+		for _, code := range policy.RetryableErrorCodes {
+			if e.ErrorCode == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// shouldRetry returns true if the attempt should be retried under the policy
+func (p *RetryPolicy) shouldRetry(attempt *CallAttempt, idempotent bool) bool {
+	if p == nil || attempt.Attempt >= p.MaxAttempts {
+		return false
+	}
+	if !idempotent && !p.RetryNonIdempotent {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(p, attempt)
+	}
+	return DefaultRetryable(p, attempt)
+}
+
+// Backoff returns the time to wait before the given retry, starting from 1
+func (p *RetryPolicy) Backoff(retry int) time.Duration {
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 2
+	}
+	d := float64(p.InitialBackoff) * math.Pow(mult, float64(retry-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		j := math.Min(p.Jitter, 1)
+		d = d * (1 - j + 2*j*rand.Float64())
+	}
+	return time.Duration(d)
+}
+
+// sleep waits for d, or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,87 @@
+package lbclient
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func failingServer(failures int, status int, failBody string, calls *int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		if *calls <= failures {
+			w.WriteHeader(status)
+			w.Write([]byte(failBody))
+			return
+		}
+		w.Write([]byte(`{"status":"COMPLETE","matchCount":0,"modifiedCount":1}`))
+	}
+}
+
+func testRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+}
+
+func TestRetryFind(t *testing.T) {
+	calls := 0
+	srv, cli := testServer(failingServer(2, http.StatusServiceUnavailable, "unavailable", &calls))
+	defer srv.Close()
+	cli.Config.RetryPolicy = testRetryPolicy()
+
+	resp, err := cli.Find(&FindRequest{RequestHeader: RequestHeader{EntityName: "test"}}, nil)
+	if err != nil || resp.Status != COMPLETE || calls != 3 {
+		t.Errorf("Unexpected result: %v %v %d", resp, err, calls)
+	}
+}
+
+func TestRetryInsertNotIdempotent(t *testing.T) {
+	calls := 0
+	srv, cli := testServer(failingServer(1, http.StatusBadGateway, "bad gateway", &calls))
+	defer srv.Close()
+	cli.Config.RetryPolicy = testRetryPolicy()
+
+	cli.Insert(&InsertRequest{RequestHeader: RequestHeader{EntityName: "test"}}, nil)
+	if calls != 1 {
+		t.Errorf("Expected 1 call, got %d", calls)
+	}
+
+	calls = 0
+	cli.Config.RetryPolicy.RetryNonIdempotent = true
+	resp, err := cli.Insert(&InsertRequest{RequestHeader: RequestHeader{EntityName: "test"}}, nil)
+	if err != nil || resp.ModifiedCount != 1 || calls != 2 {
+		t.Errorf("Unexpected result: %v %v %d", resp, err, calls)
+	}
+}
+
+func TestRetryErrorCode(t *testing.T) {
+	calls := 0
+	srv, cli := testServer(failingServer(1, http.StatusOK,
+		`{"status":"ERROR","errors":[{"objectType":"error","context":"c","errorCode":"mongo-crud:DatabaseError","msg":"x"}]}`, &calls))
+	defer srv.Close()
+	cli.Config.RetryPolicy = testRetryPolicy()
+
+	resp, _ := cli.Find(&FindRequest{RequestHeader: RequestHeader{EntityName: "test"}}, nil)
+	if calls != 1 || resp.Status != ERROR {
+		t.Errorf("Expected no retries, got %d", calls)
+	}
+
+	calls = 0
+	cli.Config.RetryPolicy.RetryableErrorCodes = []string{"mongo-crud:DatabaseError"}
+	resp, err := cli.Find(&FindRequest{RequestHeader: RequestHeader{EntityName: "test"}}, nil)
+	if err != nil || resp.Status != COMPLETE || calls != 2 {
+		t.Errorf("Unexpected result: %v %v %d", resp, err, calls)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3}
+	if p.Backoff(1) != 100*time.Millisecond || p.Backoff(2) != 300*time.Millisecond || p.Backoff(4) != time.Second {
+		t.Errorf("Unexpected backoff: %s %s %s", p.Backoff(1), p.Backoff(2), p.Backoff(4))
+	}
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if b := p.Backoff(1); b < 50*time.Millisecond || b > 150*time.Millisecond {
+			t.Errorf("Backoff out of range: %s", b)
+		}
+	}
+}
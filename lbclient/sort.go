@@ -57,3 +57,45 @@ func (s Sort) MarshalJSON() ([]byte, error) {
 		return json.Marshal(s.Keys)
 	}
 }
+
+// UnmarshalJSON decodes a sort key of the form {field:"$asc"|"$desc"}
+func (s *SortKey) UnmarshalJSON(data []byte) error {
+	m, err := jsonObject(data)
+	if err != nil {
+		return err
+	}
+	if len(m) != 1 {
+		return fmt.Errorf("Sort key must have exactly one field: %s", string(data))
+	}
+	for field := range m {
+		dir, err := jsonString(m, field)
+		if err != nil {
+			return err
+		}
+		switch dir {
+		case "$asc":
+			*s = SortKey{Field: field}
+		case "$desc":
+			*s = SortKey{Field: field, Descending: true}
+		default:
+			return fmt.Errorf("%s: invalid sort direction %s", field, dir)
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON decodes a single sort key, or an array of sort keys
+func (s *Sort) UnmarshalJSON(data []byte) error {
+	arr, err := jsonArray(data)
+	if err != nil {
+		return err
+	}
+	keys := make([]SortKey, len(arr))
+	for i, x := range arr {
+		if err := keys[i].UnmarshalJSON(x); err != nil {
+			return fmt.Errorf("sort[%d]: %s", i, err)
+		}
+	}
+	s.Keys = keys
+	return nil
+}
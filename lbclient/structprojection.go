@@ -0,0 +1,124 @@
+package lbclient
+
+import (
+	"reflect"
+	"sync"
+)
+
+var structProjections sync.Map
+
+// ProjectionFor returns a projection that includes the fields of a
+// struct type, so the documents decoded into the struct are retrieved
+// with only the fields they use. Pointer, slice and array types are
+// dereferenced to their element types. Field names are taken from
+// json tags, and embedded structs are flattened the way encoding/json
+// does. The projection contains:
+//
+//   - IncludeField(field) for scalar fields, including dates and types
+//     with JSON or text marshalers,
+//   - the fields of nested structs as field.nested,
+//   - the fields of struct array elements as field.*.nested,
+//   - IncludeTree(field) for arrays of scalars, maps, interfaces, and
+//     recursive struct types.
+//
+// If the type is not a struct, ProjectionFor returns nil, meaning all
+// fields are included. Projections are computed once per type, and
+// a new copy is returned for each call
+func ProjectionFor(t reflect.Type) *Projection {
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || isScalarType(t) {
+		return nil
+	}
+	if p, ok := structProjections.Load(t); ok {
+		return MakeProjection(p.([]projectionPart)...)
+	}
+	var parts []projectionPart
+	structFields(t, "", map[reflect.Type]bool{}, &parts)
+	structProjections.Store(t, parts)
+	return MakeProjection(parts...)
+}
+
+// ProjectionOf returns ProjectionFor the type T
+func ProjectionOf[T any]() *Projection {
+	return ProjectionFor(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// structFields adds the projections for the fields of the struct type
+// t. visiting contains the struct types being processed, to detect
+// recursive types
+func structFields(t reflect.Type, prefix string, visiting map[reflect.Type]bool, parts *[]projectionPart) {
+	visiting[t] = true
+	defer delete(visiting, t)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, skip := jsonField(sf)
+		if skip {
+			continue
+		}
+		ft := sf.Type
+		if sf.Anonymous && len(name) == 0 {
+			et := ft
+			if et.Kind() == reflect.Ptr {
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct && !isScalarType(et) {
+				if !visiting[et] {
+					structFields(et, prefix, visiting, parts)
+				}
+				continue
+			}
+			if !sf.IsExported() {
+				continue
+			}
+		}
+		if len(name) == 0 {
+			name = sf.Name
+		}
+		fieldProjection(ft, joinField(prefix, name), visiting, parts)
+	}
+}
+
+// fieldProjection adds the projections for a field of type t
+func fieldProjection(t reflect.Type, field string, visiting map[reflect.Type]bool, parts *[]projectionPart) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if isScalarType(t) {
+		*parts = append(*parts, IncludeField(field, false))
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if visiting[t] {
+			*parts = append(*parts, IncludeTree(field))
+			return
+		}
+		n := len(*parts)
+		structFields(t, field, visiting, parts)
+		if len(*parts) == n {
+			// A struct without encoded fields
+			*parts = append(*parts, IncludeField(field, false))
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Binary
+			*parts = append(*parts, IncludeField(field, false))
+			return
+		}
+		et := t.Elem()
+		for et.Kind() == reflect.Ptr {
+			et = et.Elem()
+		}
+		if et.Kind() == reflect.Struct && !isScalarType(et) && !visiting[et] {
+			fieldProjection(et, field+".*", visiting, parts)
+			return
+		}
+		*parts = append(*parts, IncludeTree(field))
+	case reflect.Map, reflect.Interface:
+		*parts = append(*parts, IncludeTree(field))
+	default:
+		*parts = append(*parts, IncludeField(field, false))
+	}
+}
@@ -0,0 +1,117 @@
+package lbclient
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type projAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip,omitempty"`
+}
+
+type projBase struct {
+	ID string `json:"_id"`
+}
+
+type projNode struct {
+	Name     string      `json:"name"`
+	Children []*projNode `json:"children"`
+	Parent   *projNode   `json:"parent"`
+}
+
+type projDoc struct {
+	projBase
+	Name     string                 `json:"name"`
+	Age      *int                   `json:"age"`
+	Created  Date                   `json:"created"`
+	Tags     []string               `json:"tags"`
+	Address  projAddress            `json:"address"`
+	Previous []projAddress          `json:"previous"`
+	Extra    map[string]interface{} `json:"extra"`
+	Raw      json.RawMessage        `json:"raw"`
+	Data     []byte                 `json:"data"`
+	Tree     projNode               `json:"tree"`
+	Ignored  string                 `json:"-"`
+	NoTag    bool
+	private  string
+}
+
+func TestProjectionFor(t *testing.T) {
+	expected := `[{"field":"_id","include":true,"recursive":false},` +
+		`{"field":"name","include":true,"recursive":false},` +
+		`{"field":"age","include":true,"recursive":false},` +
+		`{"field":"created","include":true,"recursive":false},` +
+		`{"field":"tags","include":true,"recursive":true},` +
+		`{"field":"address.city","include":true,"recursive":false},` +
+		`{"field":"address.zip","include":true,"recursive":false},` +
+		`{"field":"previous.*.city","include":true,"recursive":false},` +
+		`{"field":"previous.*.zip","include":true,"recursive":false},` +
+		`{"field":"extra","include":true,"recursive":true},` +
+		`{"field":"raw","include":true,"recursive":false},` +
+		`{"field":"data","include":true,"recursive":false},` +
+		`{"field":"tree.name","include":true,"recursive":false},` +
+		`{"field":"tree.children","include":true,"recursive":true},` +
+		`{"field":"tree.parent","include":true,"recursive":true},` +
+		`{"field":"NoTag","include":true,"recursive":false}]`
+	for _, typ := range []reflect.Type{reflect.TypeOf(projDoc{}), reflect.TypeOf([]*projDoc{})} {
+		p := ProjectionFor(typ)
+		b, _ := json.Marshal(p)
+		if string(b) != expected {
+			t.Errorf("Expected %s, got %s", expected, string(b))
+		}
+	}
+	b, _ := json.Marshal(ProjectionOf[projAddress]())
+	if string(b) != `[{"field":"city","include":true,"recursive":false},{"field":"zip","include":true,"recursive":false}]` {
+		t.Errorf("Wrong projection: %s", string(b))
+	}
+	if p := ProjectionFor(reflect.TypeOf(map[string]interface{}{})); p != nil {
+		t.Errorf("Expected nil projection for map")
+	}
+	if p := ProjectionOf[Date](); p != nil {
+		t.Errorf("Expected nil projection for date")
+	}
+	// Modifying the returned projection does not change the cached one
+	p := ProjectionOf[projAddress]()
+	p.Add(IncludeField("x", false))
+	if len(ProjectionOf[projAddress]().p) != 2 {
+		t.Errorf("Cached projection modified")
+	}
+}
+
+func TestAutoProjection(t *testing.T) {
+	var projection interface{}
+	srv, cli := testServer(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		projection = req["projection"]
+		w.Write([]byte(`{"status":"COMPLETE","processed":[{"city":"x"}]}`))
+	})
+	defer srv.Close()
+
+	req := &FindRequest{RequestHeader: RequestHeader{EntityName: "test"}}
+	cli.Find(req, reflect.TypeOf(projAddress{}))
+	if projection != nil {
+		t.Errorf("Unexpected projection: %v", projection)
+	}
+	cli.Config.AutoProjection = true
+	resp, err := cli.Find(req, reflect.TypeOf(projAddress{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if arr, ok := projection.([]interface{}); !ok || len(arr) != 2 {
+		t.Errorf("Expected projection, got %v", projection)
+	}
+	if req.P != nil {
+		t.Errorf("Request modified")
+	}
+	if doc, ok := resp.EntityData.(projAddress); !ok || doc.City != "x" {
+		t.Errorf("Wrong data: %v", resp.EntityData)
+	}
+	cli.Find(req, nil)
+	if projection != nil {
+		t.Errorf("Unexpected projection without result type: %v", projection)
+	}
+}
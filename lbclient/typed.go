@@ -0,0 +1,127 @@
+package lbclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+)
+
+// ErrNotFound is returned by FindOne if there are no matching documents
+var ErrNotFound = errors.New("No results")
+
+// TypedResponse is a Response whose documents are decoded into []T.
+// It is returned by Find, Insert, Save and UpdateAs. These are
+// generic counterparts of the DataServiceClient methods. UpdateAs has
+// an As suffix because Update is the update expression type
+type TypedResponse[T any] struct {
+	Response
+	// The documents returned in the response
+	Data []T
+}
+
+// typedCall calls the client with []T as the return data type, and
+// converts the response to a TypedResponse. If the call returns a
+// response with an error, such as the lightblue response of a non-2xx
+// HTTP status with an HTTPError, both are returned
+func typedCall[T any](call func(data interface{}) (*Response, error)) (*TypedResponse[T], error) {
+	resp, err := call(reflect.TypeOf([]T(nil)))
+	if resp == nil {
+		return nil, err
+	}
+	ret := TypedResponse[T]{Response: *resp}
+	data, derr := typedData[T](resp.EntityData)
+	if err != nil {
+		ret.Data = data
+		return &ret, err
+	}
+	if derr != nil {
+		return nil, derr
+	}
+	ret.Data = data
+	ret.EntityData = ret.Data
+	return &ret, nil
+}
+
+// typedData converts the entity data of a response to []T. The
+// entity data is already []T when it is decoded by DataCall. Other
+// shapes, such as map trees returned by other DataServiceClient
+// implementations, are converted using JSON
+func typedData[T any](data interface{}) ([]T, error) {
+	switch t := data.(type) {
+	case nil:
+		return nil, nil
+	case []T:
+		return t, nil
+	case T:
+		return []T{t}, nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var ret []T
+	if err = json.Unmarshal(b, &ret); err != nil {
+		var single T
+		if json.Unmarshal(b, &single) != nil {
+			return nil, err
+		}
+		ret = []T{single}
+	}
+	return ret, nil
+}
+
+// Find issues a find request, and returns the documents as []T
+func Find[T any](ctx context.Context, client ContextDataServiceClient, request *FindRequest) (*TypedResponse[T], error) {
+	return typedCall[T](func(data interface{}) (*Response, error) {
+		return client.FindContext(ctx, request, data)
+	})
+}
+
+// FindOne issues a find request that is expected to return a single
+// document. Returns ErrNotFound if there are no matching documents,
+// the first error or data error of the response if the response has
+// errors, or an error if there are more than one documents. The
+// response is returned with the error if there is one
+func FindOne[T any](ctx context.Context, client ContextDataServiceClient, request *FindRequest) (T, *Response, error) {
+	var ret T
+	resp, err := Find[T](ctx, client, request)
+	if err != nil {
+		if resp != nil {
+			return ret, &resp.Response, err
+		}
+		return ret, nil, err
+	}
+	if errs := resp.AllErrors(); len(errs) > 0 {
+		return ret, &resp.Response, errs[0]
+	}
+	switch len(resp.Data) {
+	case 0:
+		return ret, &resp.Response, ErrNotFound
+	case 1:
+		return resp.Data[0], &resp.Response, nil
+	default:
+		return ret, &resp.Response, errors.New("More than one results for a non-array resultset")
+	}
+}
+
+// Insert issues an insert request, and returns the projected inserted documents as []T
+func Insert[T any](ctx context.Context, client ContextDataServiceClient, request *InsertRequest) (*TypedResponse[T], error) {
+	return typedCall[T](func(data interface{}) (*Response, error) {
+		return client.InsertContext(ctx, request, data)
+	})
+}
+
+// Save issues a save request, and returns the projected saved documents as []T
+func Save[T any](ctx context.Context, client ContextDataServiceClient, request *SaveRequest) (*TypedResponse[T], error) {
+	return typedCall[T](func(data interface{}) (*Response, error) {
+		return client.SaveContext(ctx, request, data)
+	})
+}
+
+// UpdateAs issues an update request, and returns the projected updated documents as []T
+func UpdateAs[T any](ctx context.Context, client ContextDataServiceClient, request *UpdateRequest) (*TypedResponse[T], error) {
+	return typedCall[T](func(data interface{}) (*Response, error) {
+		return client.UpdateContext(ctx, request, data)
+	})
+}
@@ -0,0 +1,84 @@
+package lbclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+type typedTestDoc struct {
+	Id   string `json:"_id"`
+	Name string `json:"name"`
+}
+
+func TestFind(t *testing.T) {
+	srv, cli := testServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"COMPLETE","matchCount":2,"processed":[{"_id":"1","name":"a"},{"_id":"2","name":"b"}]}`))
+	})
+	defer srv.Close()
+
+	resp, err := Find[typedTestDoc](context.Background(), cli, &FindRequest{RequestHeader: RequestHeader{EntityName: "test"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.MatchCount != 2 || len(resp.Data) != 2 || resp.Data[0].Id != "1" || resp.Data[1].Name != "b" {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+
+	_, _, err = FindOne[typedTestDoc](context.Background(), cli, &FindRequest{RequestHeader: RequestHeader{EntityName: "test"}})
+	if err == nil {
+		t.Error("Expected error for more than one results")
+	}
+}
+
+func TestFindOne(t *testing.T) {
+	body := `{"status":"COMPLETE","matchCount":1,"processed":[{"_id":"1","name":"a"}]}`
+	srv, cli := testServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})
+	defer srv.Close()
+
+	doc, resp, err := FindOne[typedTestDoc](context.Background(), cli, &FindRequest{RequestHeader: RequestHeader{EntityName: "test"}})
+	if err != nil || doc.Id != "1" || doc.Name != "a" || resp.MatchCount != 1 {
+		t.Errorf("Unexpected result: %+v %v", doc, err)
+	}
+
+	body = `{"status":"COMPLETE","matchCount":0,"processed":[]}`
+	_, _, err = FindOne[typedTestDoc](context.Background(), cli, &FindRequest{RequestHeader: RequestHeader{EntityName: "test"}})
+	if err != ErrNotFound {
+		t.Errorf("Expected not found, got %v", err)
+	}
+
+	body = `{"status":"PARTIAL","matchCount":1,"processed":[],"dataErrors":[{"data":{"_id":"1"},"errors":[{"errorCode":"crud:NoAccess","msg":"x"}]}]}`
+	_, _, err = FindOne[typedTestDoc](context.Background(), cli, &FindRequest{RequestHeader: RequestHeader{EntityName: "test"}})
+	if rerr, ok := err.(RequestError); !ok || rerr.ErrorCode != ERR_CRUD_NO_ACCESS {
+		t.Errorf("Expected data error, got %v", err)
+	}
+}
+
+func TestFindHTTPError(t *testing.T) {
+	srv, cli := testServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"status":"ERROR","errors":[{"errorCode":"mongo-crud:ConnectionError","msg":"x"}]}`))
+	})
+	defer srv.Close()
+
+	resp, err := Find[typedTestDoc](context.Background(), cli, &FindRequest{RequestHeader: RequestHeader{EntityName: "test"}})
+	herr, ok := err.(*HTTPError)
+	if !ok || herr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected HTTP error, got %v", err)
+	}
+	if resp == nil || resp.Status != ERROR || len(resp.Errors) != 1 || resp.Errors[0].ErrorCode != ERR_MONGO_CONNECTION {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+	if _, r, err := FindOne[typedTestDoc](context.Background(), cli, &FindRequest{RequestHeader: RequestHeader{EntityName: "test"}}); err == nil || r == nil || r.Status != ERROR {
+		t.Errorf("Unexpected result: %+v %v", r, err)
+	}
+}
+
+func TestTypedData(t *testing.T) {
+	docs, err := typedData[typedTestDoc]([]interface{}{map[string]interface{}{"_id": "1", "name": "a"}})
+	if err != nil || len(docs) != 1 || docs[0].Id != "1" {
+		t.Errorf("Unexpected result: %+v %v", docs, err)
+	}
+}
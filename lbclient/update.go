@@ -1,8 +1,12 @@
 package lbclient
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"sort"
+
+	"github.com/lightblue-platform/go-client/lbclient/internal/eval"
 )
 
 type updatePart interface {
@@ -99,7 +103,7 @@ type ForEachOperation struct {
 		isAll bool
 	}
 	u struct {
-		u        Update
+		u        *Update
 		isRemove bool
 	}
 }
@@ -107,14 +111,16 @@ type ForEachOperation struct {
 func (s ForEachOperation) GetMap() map[string]interface{} {
 	m := make(map[string]interface{})
 	if s.q.isAll {
-		m["field"] = "$all"
+		m[s.field] = "$all"
 	} else {
-		m["field"] = s.q.q
+		m[s.field] = s.q.q
 	}
 	if s.u.isRemove {
 		m["$update"] = "$remove"
+	} else if s.u.u == nil {
+		m["$update"] = Update{}
 	} else {
-		m["$update"] = s.u.u
+		m["$update"] = *s.u.u
 	}
 	return map[string]interface{}{
 		"$foreach": m}
@@ -147,6 +153,17 @@ func (u *Update) Set(fld string, val RValue) *Update {
 	return u.add(SetOperation{field: fld, value: val})
 }
 
+// Adds a $set operation to the update expression, with val converted
+// using LitOf unless it is an RValue. If val cannot be converted, the
+// update expression is not changed and an error is returned
+func (u *Update) SetOf(fld string, val interface{}) (*Update, error) {
+	r, err := rvalueOf(val)
+	if err != nil {
+		return u, err
+	}
+	return u.Set(fld, r), nil
+}
+
 // Adds an $unset operation to the update expression
 func (u *Update) Unset(fld string) *Update {
 	return u.add(UnsetOperation{fld})
@@ -157,6 +174,16 @@ func (u *Update) Add(fld string, val RValue) *Update {
 	return u.add(AddOperation{field: fld, value: val})
 }
 
+// Adds a $add operation to the update expression, with val converted
+// like SetOf
+func (u *Update) AddOf(fld string, val interface{}) (*Update, error) {
+	r, err := rvalueOf(val)
+	if err != nil {
+		return u, err
+	}
+	return u.Add(fld, r), nil
+}
+
 // Adds an $append operation to the update epxression
 func (u *Update) Append(fld string, val ...RValue) *Update {
 	return u.add(AppendOperation{field: fld, values: val})
@@ -177,13 +204,55 @@ func (u *Update) InsertList(fld string, val []RValue) *Update {
 	return u.add(InsertOperation{field: fld, values: val})
 }
 
-// Adds a $foreach operation to the update expression
-func (u *Update) ForEach(fld string, query Query, all bool, update Update, remove bool) *Update {
-	f := ForEachOperation{field: fld}
-	f.q.q = query
-	f.q.isAll = all
+// Adds a $foreach operation to the update expression, applying
+// update to the elements of the array fld matching query. If query is
+// nil, all elements are updated ($all). A nil update is an empty
+// update. Field names in update are relative to the array element.
+// Use Remove to remove elements
+func (u *Update) ForEach(fld string, query *Query, update *Update) *Update {
+	f := newForEach(fld, query)
+	if update == nil {
+		update = &Update{}
+	}
 	f.u.u = update
-	f.u.isRemove = remove
+	return u.add(f)
+}
+
+// newForEach returns a $foreach operation for the elements of the
+// array fld matching query, or all elements if query is nil
+func newForEach(fld string, query *Query) ForEachOperation {
+	f := ForEachOperation{field: fld}
+	if query == nil {
+		f.q.isAll = true
+	} else {
+		f.q.q = *query
+	}
+	return f
+}
+
+// Adds a $foreach operation updating the elements of the array fld
+// matching query, or all elements if query is nil, and returns the
+// update for the elements. Field names of the returned update are
+// relative to the array element:
+//
+//	u := new(Update).Set("status", LitStr("shipped"))
+//	u.ForEachElement("items", CmpValue("id", EQ, LitInt(1))).
+//		Set("qty", LitInt(2)).
+//		Unset("reserved")
+//
+// The element update can be modified until the update is sent
+func (u *Update) ForEachElement(fld string, query *Query) *Update {
+	elem := &Update{}
+	u.ForEach(fld, query, elem)
+	return elem
+}
+
+// Adds a $foreach operation removing the elements of the array fld
+// matching query, or all elements if query is nil. An update can
+// contain multiple removals, which are applied in order
+func (u *Update) Remove(fld string, query *Query) *Update {
+	f := newForEach(fld, query)
+	f.u.isRemove = true
 	return u.add(f)
 }
 
@@ -202,7 +271,198 @@ func (u Update) MarshalJSON() ([]byte, error) {
 	}
 }
 
+// Apply applies the update expression to doc the way the server
+// would, and can be used to preview changes. All of $set, $unset,
+// $add, $append, $insert (with the index as the last segment of the
+// field), $foreach with a query or $all and a nested update or
+// $remove, and $valueof are supported. Field names can contain array
+// indexes, and $valueof fields in $foreach updates are relative to
+// the array element.
+//
+// Values of doc that are not JSON trees, such as structs, typed
+// slices and time.Time, are replaced by their JSON representations,
+// with dates in the lightblue date format. Values set by the update
+// are JSON trees with numbers as json.Number. If the update fails,
+// doc is not modified
+func (u *Update) Apply(doc map[string]interface{}) error {
+	if u.Empty() {
+		return nil
+	}
+	update, err := jsonTree(u)
+	if err != nil {
+		return err
+	}
+	tree, err := treeCopy(doc)
+	if err != nil {
+		return err
+	}
+	result := tree.(map[string]interface{})
+	if err := eval.Apply(update, result); err != nil {
+		return err
+	}
+	for k := range doc {
+		if _, ok := result[k]; !ok {
+			delete(doc, k)
+		}
+	}
+	for k, v := range result {
+		doc[k] = v
+	}
+	return nil
+}
+
 func (u *Update) String() string {
 	x, _ := u.MarshalJSON()
 	return string(x)
 }
+
+// UnmarshalJSON decodes a single update operation, or an array of
+// update operations. $set, $add, $append and $insert operations with
+// multiple fields are decoded as one operation per field, in field
+// name order
+func (u *Update) UnmarshalJSON(data []byte) error {
+	arr, err := jsonArray(data)
+	if err != nil {
+		return err
+	}
+	ret := Update{}
+	for i, x := range arr {
+		if err := ret.parsePart(x); err != nil {
+			if len(arr) > 1 {
+				return fmt.Errorf("update[%d]: %s", i, err)
+			}
+			return err
+		}
+	}
+	*u = ret
+	return nil
+}
+
+func (u *Update) parsePart(data []byte) error {
+	m, err := jsonObject(data)
+	if err != nil {
+		return err
+	}
+	if len(m) != 1 {
+		return fmt.Errorf("Update operation must have exactly one operator: %s", string(data))
+	}
+	for op, raw := range m {
+		if op == "$unset" {
+			fields, err := jsonArray(raw)
+			if err != nil {
+				return fmt.Errorf("$unset: %s", err)
+			}
+			for _, f := range fields {
+				var field string
+				if err := json.Unmarshal(f, &field); err != nil {
+					return fmt.Errorf("$unset: expected field name")
+				}
+				u.Unset(field)
+			}
+			return nil
+		}
+		if op == "$foreach" {
+			f, err := parseForEach(raw)
+			if err != nil {
+				return fmt.Errorf("$foreach: %s", err)
+			}
+			u.add(f)
+			return nil
+		}
+		fields, err := jsonObject(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %s", op, err)
+		}
+		for _, field := range sortedKeys(fields) {
+			switch op {
+			case "$set", "$add":
+				value, err := parseRValue(fields[field])
+				if err != nil {
+					return fmt.Errorf("%s: %s: %s", op, field, err)
+				}
+				if op == "$set" {
+					u.Set(field, value)
+				} else {
+					u.Add(field, value)
+				}
+			case "$append", "$insert":
+				values, err := parseRValues(fields[field])
+				if err != nil {
+					return fmt.Errorf("%s: %s: %s", op, field, err)
+				}
+				if op == "$append" {
+					u.AppendList(field, values)
+				} else {
+					u.InsertList(field, values)
+				}
+			default:
+				return fmt.Errorf("Unknown update operator %s", op)
+			}
+		}
+	}
+	return nil
+}
+
+// parseForEach decodes {array:query|"$all", "$update":update|"$remove"}
+func parseForEach(data []byte) (ForEachOperation, error) {
+	f := ForEachOperation{}
+	m, err := jsonObject(data)
+	if err != nil {
+		return f, err
+	}
+	upd, ok := m["$update"]
+	if !ok {
+		return f, fmt.Errorf("Missing $update")
+	}
+	if len(m) != 2 {
+		return f, fmt.Errorf("Expected exactly one array field")
+	}
+	if isJSONString(upd, "$remove") {
+		f.u.isRemove = true
+	} else {
+		f.u.u = &Update{}
+		if err := f.u.u.UnmarshalJSON(upd); err != nil {
+			return f, fmt.Errorf("$update: %s", err)
+		}
+	}
+	for field, raw := range m {
+		if field == "$update" {
+			continue
+		}
+		f.field = field
+		if isJSONString(raw, "$all") {
+			f.q.isAll = true
+		} else if err := f.q.q.UnmarshalJSON(raw); err != nil {
+			return f, fmt.Errorf("%s: %s", field, err)
+		}
+	}
+	return f, nil
+}
+
+func parseRValues(data []byte) ([]RValue, error) {
+	arr, err := jsonArray(data)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]RValue, len(arr))
+	for i, x := range arr {
+		if values[i], err = parseRValue(x); err != nil {
+			return nil, fmt.Errorf("[%d]: %s", i, err)
+		}
+	}
+	return values, nil
+}
+
+func isJSONString(data []byte, s string) bool {
+	x, _ := json.Marshal(s)
+	return bytes.Equal(bytes.TrimSpace(data), x)
+}
+
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -1,8 +1,10 @@
 package lbclient
 
 import (
+	"encoding/json"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestUpdateEmpty(t *testing.T) {
@@ -18,3 +20,114 @@ func TestUpdateSet(t *testing.T) {
 	x.Set("field", ValueOfField("f"))
 	cmp(t, strings.Replace("{'$set':{'field':{'$valueof':'f'}}}", "'", "\"", -1), x)
 }
+
+func TestUpdateApply(t *testing.T) {
+	doc := map[string]interface{}{
+		"name":  "a",
+		"count": 1,
+		"tags":  []interface{}{"x", "z"},
+		"obj":   map[string]interface{}{"f": "v", "g": 1},
+		"old":   true,
+	}
+	var u Update
+	u.Set("name", LitStr("b")).
+		Set("copy", ValueOfField("obj")).
+		Add("count", LitInt(2)).
+		Append("tags", LitStr("w")).
+		Insert("tags.1", LitStr("y")).
+		Unset("obj.g").
+		Unset("old")
+	if err := u.Apply(doc); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(doc)
+	expected := `{"copy":{"f":"v","g":1},"count":3,"name":"b","obj":{"f":"v"},"tags":["x","y","z","w"]}`
+	if string(b) != expected {
+		t.Errorf("Expected %s, got %s", expected, string(b))
+	}
+}
+
+func TestUpdateApplyStruct(t *testing.T) {
+	type item struct {
+		Name string `json:"name"`
+	}
+	doc := map[string]interface{}{
+		"items":   []item{{Name: "a"}, {Name: "b"}},
+		"created": time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	var u Update
+	u.Set("items.1.name", LitStr("c"))
+	if err := u.Apply(doc); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(doc)
+	expected := `{"created":"20200102T03:04:05.000+0000","items":[{"name":"a"},{"name":"c"}]}`
+	if string(b) != expected {
+		t.Errorf("Expected %s, got %s", expected, string(b))
+	}
+}
+
+func TestUpdateApplyError(t *testing.T) {
+	doc := map[string]interface{}{"name": "a", "arr": "x"}
+	var u Update
+	u.Set("name", LitStr("b")).Append("arr", LitStr("y"))
+	if err := u.Apply(doc); err == nil {
+		t.Error("Expected error")
+	}
+	if doc["name"] != "a" || doc["arr"] != "x" {
+		t.Errorf("Document modified: %v", doc)
+	}
+	var empty Update
+	if err := empty.Apply(doc); err != nil || len(doc) != 2 {
+		t.Errorf("Empty update: %v %v", err, doc)
+	}
+}
+
+func TestUpdateForEach(t *testing.T) {
+	u := new(Update).Set("status", LitStr("shipped"))
+	u.ForEachElement("items", CmpValue("id", EQ, LitInt(1))).Set("qty", LitInt(2)).Unset("reserved")
+	cmp(t, `[{"$set":{"status":"shipped"}},{"$foreach":{"$update":[{"$set":{"qty":2}},{"$unset":"reserved"}],"items":{"field":"id","op":"=","rvalue":1}}}]`, u)
+
+	doc := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"id": 1, "qty": 1, "reserved": true},
+			map[string]interface{}{"id": 2, "qty": 1, "reserved": true},
+		},
+	}
+	if err := u.Apply(doc); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(doc)
+	expected := `{"items":[{"id":1,"qty":2},{"id":2,"qty":1,"reserved":true}],"status":"shipped"}`
+	if string(b) != expected {
+		t.Errorf("Expected %s, got %s", expected, string(b))
+	}
+
+	var all Update
+	all.ForEachElement("items", nil).Add("qty", LitInt(1))
+	cmp(t, `{"$foreach":{"$update":{"$add":{"qty":1}},"items":"$all"}}`, all)
+
+	// A nil update is empty, it does not remove the elements
+	cmp(t, `{"$foreach":{"$update":[],"items":"$all"}}`, new(Update).ForEach("items", nil, nil))
+}
+
+func TestUpdateRemove(t *testing.T) {
+	var u Update
+	u.Remove("a", CmpValue("$this", EQ, LitInt(1))).
+		Remove("b", CmpValue("x", NEQ, LitInt(1))).
+		Remove("c", nil)
+	cmp(t, `[{"$foreach":{"$update":"$remove","a":{"field":"$this","op":"=","rvalue":1}}},{"$foreach":{"$update":"$remove","b":{"field":"x","op":"!=","rvalue":1}}},{"$foreach":{"$update":"$remove","c":"$all"}}]`, u)
+	doc := map[string]interface{}{
+		"a": []interface{}{1, 2, 1},
+		"b": []interface{}{map[string]interface{}{"x": 1}, map[string]interface{}{"x": 2}},
+		"c": []interface{}{"x"},
+	}
+	if err := u.Apply(doc); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(doc)
+	expected := `{"a":[2],"b":[{"x":1}],"c":[]}`
+	if string(b) != expected {
+		t.Errorf("Expected %s, got %s", expected, string(b))
+	}
+}